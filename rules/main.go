@@ -2,24 +2,56 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"time"
 
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/addresses"
 	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cobra"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/accumulate"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3/jsonrpc"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
 )
 
 var flag = struct {
-	Network string
+	Network  string
+	RulesDir string
+	Ruleset  string
+	Explain  bool
+	Out      string
+	JUnit    string
+	Coverage string
+	Locale   string
+	Catalog  string
+	AsOf     string
+	Replay   string
+	Policy   string
+	To       string
+	Amount   string
+	Token    string
+	Memo     string
+	Sanction string
+	Addrs    string
+	Anchors  []string
+	SignKey  string
+	Keys     []string
+	Entry    string
+	ChainID  uint64
+	Lifetime time.Duration
+	UserOp   string
 }{}
 
 var cmd = &cobra.Command{
@@ -36,9 +68,62 @@ var cmdOnce = &cobra.Command{
 	Run:   runOnce,
 }
 
+var cmdCompile = &cobra.Command{
+	Use:   "compile [dir]",
+	Short: "Compile the EDD and decision table workbooks (edd.xls and dt.xls) in a directory",
+	Args:  cobra.ExactArgs(1),
+	Run:   runCompile,
+}
+
+var cmdLint = &cobra.Command{
+	Use:   "lint [dir]",
+	Short: "Check the decision tables of the rulesets in a directory, or the built-in rules, for problems",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runLint,
+}
+
+var cmdTest = &cobra.Command{
+	Use:   "test [dir]",
+	Short: "Run the rule fixtures in a directory offline",
+	Args:  cobra.ExactArgs(1),
+	Run:   runTest,
+}
+
+var cmdVerify = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Verify the attestation of a result, or a bare attestation, offline (- reads stdin)",
+	Args:  cobra.ExactArgs(1),
+	Run:   runVerify,
+}
+
 func main() {
-	cmd.AddCommand(cmdOnce)
+	cmd.AddCommand(cmdOnce, cmdCompile, cmdLint, cmdTest, cmdVerify)
+	cmdOnce.Flags().StringVar(&flag.Ruleset, "ruleset", "", "The name of the ruleset to execute")
+	cmdOnce.Flags().BoolVar(&flag.Explain, "explain", false, "Include a trace of the conditions, cases, and actions that were evaluated")
+	cmdOnce.Flags().StringVar(&flag.AsOf, "as-of", "", "Evaluate the certificate as of a time (RFC 3339) or date (YYYY-MM-DD) instead of now")
+	cmdOnce.Flags().StringVar(&flag.Replay, "replay", "", "Evaluate the on-chain state at a past time (RFC 3339), date (YYYY-MM-DD), or block height")
+	cmdTest.Flags().StringVar(&flag.AsOf, "as-of", "", "Evaluate fixtures that do not specify asOf at a time (RFC 3339) or date (YYYY-MM-DD) instead of now")
+	cmdOnce.Flags().StringVar(&flag.Policy, "aggregation", "", "How to combine the results of an identity with several certificates: all-valid, any-valid, or highest-tier, where the riskiest certificate decides (defaults to the ruleset's policy)")
+	cmdOnce.Flags().StringVar(&flag.To, "to", "", "Screen a transfer from the account to a recipient ADI or EVM address")
+	cmdOnce.Flags().StringVar(&flag.Amount, "amount", "0", "The amount of the transfer, in the token's base units")
+	cmdOnce.Flags().StringVar(&flag.Token, "token", "", "The token contract address of the transfer")
+	cmdOnce.Flags().StringVar(&flag.Memo, "memo", "", "The memo of the transfer")
+	cmdOnce.Flags().StringVar(&flag.Locale, "locale", "", "The locale of the denial messages, such as de or pt-BR")
+	cmdOnce.Flags().StringVar(&flag.UserOp, "user-op-hash", "", "Bind the signed decision to the hash of an ERC-4337 UserOperation")
+	cmdCompile.Flags().StringVarP(&flag.Out, "out", "o", "", "Write the compiled XML to this directory instead of the source directory")
+	cmdTest.Flags().StringVar(&flag.JUnit, "junit", "", "Write a JUnit XML report to this file")
+	cmdTest.Flags().StringVar(&flag.Coverage, "coverage", "", "Report which cases, conditions, and actions were exercised (text or json)")
+	cmdVerify.Flags().StringSliceVar(&flag.Keys, "key", nil, "Require the attestation to be signed by this public key (hex, may be repeated)")
 	cmd.PersistentFlags().StringVarP(&flag.Network, "network", "n", "https://mainnet.accumulatenetwork.io", "The Accumulate network endpoint")
+	cmd.PersistentFlags().StringVar(&flag.Catalog, "catalog", "", "Load additional denial message catalogs (one file per locale) from a directory")
+	cmd.PersistentFlags().StringVar(&flag.Sanction, "sanctions", "", "Load sanctions lists (OFAC SDN XML or CSV, or JSON) from a directory")
+	cmd.PersistentFlags().StringVar(&flag.Addrs, "addresses", "", "Load EVM address denylists, risk labels, and a code map from a directory")
+	cmd.PersistentFlags().StringSliceVar(&flag.Anchors, "anchor", nil, "Prove the fetched entries up to a trusted directory network anchor (height:root, may be repeated)")
+	cmd.PersistentFlags().StringVar(&flag.SignKey, "signing-key", "", "Sign every result with the key in this file (ed25519:<hex> or secp256k1:<hex>)")
+	cmd.PersistentFlags().StringVar(&flag.Entry, "entry-point", "", "Also sign every result as an EIP-712 decision for this entry point contract (requires a secp256k1 signing key)")
+	cmd.PersistentFlags().Uint64Var(&flag.ChainID, "chain-id", rules.CitreaTestnet.ChainID, "The chain ID of the EIP-712 domain")
+	cmd.PersistentFlags().DurationVar(&flag.Lifetime, "decision-lifetime", rules.DefaultDecisionLifetime, "How long a signed decision is valid for")
+	cmd.PersistentFlags().StringVar(&flag.RulesDir, "rules-dir", "", "Load the compiled EDD and decision tables from a directory instead of using the built-in rules")
 	_ = cmd.Execute()
 }
 
@@ -52,6 +137,17 @@ func run(_ *cobra.Command, args []string) {
 	fmt.Println("Listening on", l.Addr())
 
 	client := jsonrpc.NewClient(accumulate.ResolveWellKnownEndpoint(flag.Network, "v3"))
+	// Fingerprint the rules before loading them, so a change made while they
+	// load is picked up
+	var loaded string
+	if flag.RulesDir != "" {
+		loaded = must1(rules.Fingerprint(flag.RulesDir))
+	}
+	engine := newEngine(ctx, client)
+	if flag.RulesDir != "" {
+		go engine.Watch(ctx, client, flag.RulesDir, loaded, 5*time.Second)
+	}
+
 	s := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req *rules.Request
 		var res *rules.Result
@@ -60,12 +156,24 @@ func run(_ *cobra.Command, args []string) {
 			goto error
 		}
 
-		if req.Identity == nil {
+		if req.Identity == nil && req.Transaction == nil {
 			err = fmt.Errorf("missing metadata URL")
 			goto error
 		}
 
-		res, err = rules.Execute(r.Context(), client, req)
+		if req.Locale == "" {
+			req.Locale = r.Header.Get("Accept-Language")
+		}
+
+		if v := r.URL.Query().Get("explain"); v != "" {
+			req.Explain, err = strconv.ParseBool(v)
+			if err != nil {
+				err = fmt.Errorf("invalid explain parameter: %w", err)
+				goto error
+			}
+		}
+
+		res, err = engine.Execute(r.Context(), client, req)
 		if err != nil {
 			goto error
 		}
@@ -102,15 +210,249 @@ func runOnce(_ *cobra.Command, args []string) {
 
 	req := &rules.Request{
 		Identity: must1(url.Parse(args[0])),
+		Ruleset:  flag.Ruleset,
+		Explain:  flag.Explain,
+		Locale:   flag.Locale,
+
+		Aggregation: rules.Aggregation(flag.Policy),
+		UserOpHash:  flag.UserOp,
+	}
+	if flag.To != "" {
+		req.Transaction = &rules.Transaction{
+			Sender:    req.Identity,
+			Recipient: flag.To,
+			Token:     flag.Token,
+			Amount:    json.Number(flag.Amount),
+			Memo:      flag.Memo,
+		}
+		req.Identity = nil
+	}
+	if flag.AsOf != "" {
+		req.AsOf = must1(parseAsOf(flag.AsOf))
+	}
+	if flag.Replay != "" {
+		req.Replay = new(rules.Moment)
+		if height, err := strconv.ParseUint(flag.Replay, 10, 64); err == nil {
+			req.Replay.Height = &height
+		} else {
+			req.Replay.Time = must1(parseAsOf(flag.Replay))
+		}
 	}
 
 	client := jsonrpc.NewClient(accumulate.ResolveWellKnownEndpoint(flag.Network, "v3"))
-	r := must1(rules.Execute(ctx, client, req))
+	r := must1(newEngine(ctx, client).Execute(ctx, client, req))
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	must(enc.Encode(r))
 }
 
+func runCompile(_ *cobra.Command, args []string) {
+	out := flag.Out
+	if out == "" {
+		out = args[0]
+	}
+
+	edd, dt, err := rules.CompileWorkbooks(filepath.Join(args[0], "edd.xls"), filepath.Join(args[0], "dt.xls"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	must(os.WriteFile(filepath.Join(out, "compiled_edd.xml"), edd, 0644))
+	must(os.WriteFile(filepath.Join(out, "compiled_dt.xml"), dt, 0644))
+}
+
+func runLint(_ *cobra.Command, args []string) {
+	registry := rules.DefaultRegistry()
+	if len(args) > 0 {
+		client := jsonrpc.NewClient(accumulate.ResolveWellKnownEndpoint(flag.Network, "v3"))
+		var err error
+		registry, err = rules.LoadRegistryDir(context.Background(), client, args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var failed bool
+	for _, name := range registry.Names() {
+		rs := must1(registry.Get(name))
+		for _, issue := range rules.Lint(rs) {
+			fmt.Printf("%s/%v\n", rs.Name, issue)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runTest(_ *cobra.Command, args []string) {
+	ctx := context.Background()
+	fixtures, err := rules.LoadFixtures(os.DirFS(args[0]))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var coverage *rules.Coverage
+	switch flag.Coverage {
+	case "":
+	case "text", "json":
+		coverage = rules.NewCoverage()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown coverage format %q\n", flag.Coverage)
+		os.Exit(1)
+	}
+
+	client := jsonrpc.NewClient(accumulate.ResolveWellKnownEndpoint(flag.Network, "v3"))
+	engine := newEngine(ctx, client)
+	engine.CollectCoverage(coverage)
+	if flag.AsOf != "" {
+		asOf, err := parseAsOf(flag.AsOf)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		engine.SetClock(rules.FixedClock(*asOf))
+	}
+	results := engine.RunFixtures(ctx, fixtures)
+
+	var failed int
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Printf("PASS %s\n", r.Fixture.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s (%s)\n", r.Fixture.Name, r.Fixture.File)
+		for _, f := range r.Failures {
+			fmt.Printf("    %s\n", f)
+		}
+	}
+	fmt.Printf("\n%d passed, %d failed\n", len(results)-failed, failed)
+
+	switch flag.Coverage {
+	case "text":
+		fmt.Println()
+		must(coverage.Report().WriteText(os.Stdout))
+	case "json":
+		fmt.Println()
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		must(enc.Encode(coverage.Report()))
+	}
+
+	if flag.JUnit != "" {
+		f := must1(os.Create(flag.JUnit))
+		must(rules.WriteJUnit(f, "rules", results))
+		must(f.Close())
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runVerify(_ *cobra.Command, args []string) {
+	var b []byte
+	var err error
+	if args[0] == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var keys [][]byte
+	for _, k := range flag.Keys {
+		key, err := hex.DecodeString(k)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid key %q: %v\n", k, err)
+			os.Exit(1)
+		}
+		keys = append(keys, key)
+	}
+
+	a, err := rules.ParseAttestation(b)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	s, err := rules.VerifyAttestation(a, keys...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("OK signed by %s key %s\n", a.KeyType, a.PublicKey)
+	if !s.Live {
+		fmt.Println("NOT LIVE the request set the time, replayed a moment, or overrode the aggregation policy")
+	}
+	if now := time.Now(); now.After(s.ExpiresAt) {
+		fmt.Printf("EXPIRED at %v\n", s.ExpiresAt.Format(time.RFC3339))
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	must(enc.Encode(s))
+}
+
+func parseAsOf(s string) (*time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid --as-of %q: want an RFC 3339 time or a YYYY-MM-DD date", s)
+}
+
+func newEngine(ctx context.Context, client api.Querier) *rules.Engine {
+	registry := rules.DefaultRegistry()
+	if flag.RulesDir != "" {
+		registry = must1(rules.LoadRegistryDir(ctx, client, flag.RulesDir))
+	}
+	engine := rules.NewEngine(registry)
+	if flag.Catalog != "" {
+		catalog := must1(rules.LoadCatalog(os.DirFS(flag.Catalog)))
+		engine.SetCatalog(rules.DefaultCatalog().Merge(catalog))
+	}
+	if flag.Sanction != "" {
+		engine.SetSanctions(must1(sanctions.LoadDir(flag.Sanction)))
+	}
+	if flag.Addrs != "" {
+		engine.SetAddressBook(must1(addresses.LoadDir(flag.Addrs)))
+	}
+	if len(flag.Anchors) > 0 {
+		var anchors []*rules.Anchor
+		for _, s := range flag.Anchors {
+			anchors = append(anchors, must1(rules.ParseAnchor(s)))
+		}
+		engine.SetAnchors(anchors)
+	}
+	if flag.SignKey != "" {
+		engine.SetSigningKey(must1(rules.LoadSigningKey(flag.SignKey)))
+		engine.SetDecisionLifetime(flag.Lifetime)
+	}
+	if flag.Entry != "" {
+		if key := engine.SigningKey(); key == nil || key.Type() != rules.KeySecp256k1 {
+			fmt.Fprintln(os.Stderr, "--entry-point requires a secp256k1 --signing-key")
+			os.Exit(1)
+		}
+		if !common.IsHexAddress(flag.Entry) {
+			fmt.Fprintf(os.Stderr, "invalid --entry-point %q\n", flag.Entry)
+			os.Exit(1)
+		}
+		engine.SetEip712Domain(&rules.Eip712Domain{
+			Name:              rules.Eip712Name,
+			Version:           rules.Eip712Version,
+			ChainID:           flag.ChainID,
+			VerifyingContract: common.HexToAddress(flag.Entry),
+		})
+	}
+	return engine
+}
+
 func must(err error) {
 	if err != nil {
 		panic(err)
@@ -0,0 +1,285 @@
+// Package addresses screens EVM addresses against locally maintained
+// denylists and risk-labelled address sets, and classifies them as contracts
+// or externally owned accounts with a supplied code map.
+package addresses
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Risk levels of a label, from lowest to highest.
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// Account types.
+const (
+	AccountContract = "contract"
+	AccountEOA      = "eoa"
+	AccountUnknown  = "unknown"
+)
+
+// Label is a risk label of a set of addresses.
+type Label struct {
+	Name string `json:"label"`
+	Risk string `json:"risk,omitempty"`
+
+	// Deny is set for the labels of a denylist.
+	Deny bool `json:"deny,omitempty"`
+
+	Source string `json:"source,omitempty"`
+}
+
+// Book is a set of labelled addresses and of the code of known accounts.
+type Book struct {
+	labels map[common.Address][]*Label
+	code   map[common.Address]bool
+}
+
+// Info is what the book knows about an address.
+type Info struct {
+	// Address is the checksummed address.
+	Address string   `json:"address"`
+	Labels  []*Label `json:"labels,omitempty"`
+
+	// Denylisted is set if any of the labels denies the address. Risk is the
+	// highest risk of the labels, or empty.
+	Denylisted bool   `json:"denylisted"`
+	Risk       string `json:"risk,omitempty"`
+
+	// AccountType is contract or eoa if the code map has the address, and
+	// otherwise unknown.
+	AccountType string `json:"accountType"`
+}
+
+func NewBook() *Book {
+	return &Book{labels: map[common.Address][]*Label{}, code: map[common.Address]bool{}}
+}
+
+// Add labels the addresses.
+func (b *Book) Add(label *Label, addrs ...string) error {
+	if label.Risk != "" && riskRank(label.Risk) < 0 {
+		return fmt.Errorf("label %s: invalid risk %q", label.Name, label.Risk)
+	}
+	for _, s := range addrs {
+		a, err := parseAddress(s)
+		if err != nil {
+			return err
+		}
+		b.labels[a] = append(b.labels[a], label)
+	}
+	return nil
+}
+
+// SetCode records the code of an account. An account without code is an
+// externally owned account.
+func (b *Book) SetCode(addr string, code []byte) error {
+	a, err := parseAddress(addr)
+	if err != nil {
+		return err
+	}
+	b.code[a] = len(code) > 0
+	return nil
+}
+
+// Lookup returns what the book knows about a valid address.
+func (b *Book) Lookup(addr string) (*Info, error) {
+	a, err := parseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Address: a.Hex(), Labels: b.labels[a], AccountType: AccountUnknown}
+	for _, l := range info.Labels {
+		info.Denylisted = info.Denylisted || l.Deny
+		if riskRank(l.Risk) > riskRank(info.Risk) {
+			info.Risk = l.Risk
+		}
+	}
+	if contract, ok := b.code[a]; ok {
+		info.AccountType = AccountEOA
+		if contract {
+			info.AccountType = AccountContract
+		}
+	}
+	return info, nil
+}
+
+func riskRank(risk string) int {
+	switch risk {
+	case RiskLow:
+		return 0
+	case RiskMedium:
+		return 1
+	case RiskHigh:
+		return 2
+	}
+	return -1
+}
+
+// ValidChecksum returns false if the address has mixed case and the case
+// does not match its EIP-55 checksum. An address that is all lowercase or all
+// uppercase has no checksum.
+func ValidChecksum(addr string) bool {
+	if !HasChecksum(addr) {
+		return true
+	}
+	return common.HexToAddress(addr).Hex() == "0x"+strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X")
+}
+
+// HasChecksum returns true if the address has mixed case, which is how an
+// EIP-55 checksum is encoded.
+func HasChecksum(addr string) bool {
+	hex := strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X")
+	return strings.ToLower(hex) != hex && strings.ToUpper(hex) != hex
+}
+
+func parseAddress(s string) (common.Address, error) {
+	s = strings.TrimSpace(s)
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("invalid EVM address %q", s)
+	}
+	return common.HexToAddress(s), nil
+}
+
+// codeFile is the file the code map is read from.
+const codeFile = "code.json"
+
+// LoadDir loads every address set in the directory. Files are read according
+// to their extension:
+//
+//   - .txt is a denylist with an address per line. Blank lines and lines
+//     starting with # are ignored. The label is the name of the file.
+//   - .json is a risk-labelled set, or an array of them:
+//     {"label": "mixer", "risk": "high", "deny": false, "addresses": ["0x…"]}
+//
+// The code map is read from code.json, which maps addresses to their code as
+// hex. An address with the code "0x" is an externally owned account.
+func LoadDir(dir string) (*Book, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBook()
+	var n int
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		file := filepath.Join(dir, f.Name())
+		source := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		switch {
+		case strings.EqualFold(f.Name(), codeFile):
+			err = loadFile(file, b.readCode)
+		case strings.EqualFold(filepath.Ext(f.Name()), ".txt"):
+			err = loadFile(file, func(r io.Reader) error { return b.ReadDenylist(r, source) })
+		case strings.EqualFold(filepath.Ext(f.Name()), ".json"):
+			err = loadFile(file, func(r io.Reader) error { return b.ReadLabels(r, source) })
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, errors.New("no address lists found")
+	}
+	return b, nil
+}
+
+func loadFile(file string, read func(io.Reader) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+// ReadDenylist reads a denylist with an address per line and labels the
+// addresses as denied with a high risk.
+func (b *Book) ReadDenylist(r io.Reader, name string) error {
+	label := &Label{Name: name, Risk: RiskHigh, Deny: true, Source: name}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		addr := strings.TrimSpace(s.Text())
+		if addr == "" || strings.HasPrefix(addr, "#") {
+			continue
+		}
+		err := b.Add(label, addr)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return s.Err()
+}
+
+// ReadLabels reads a risk-labelled address set, or an array of them.
+func (b *Book) ReadLabels(r io.Reader, source string) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	type set struct {
+		Label
+		Addresses []string `json:"addresses"`
+	}
+	var sets []*set
+	if len(buf) > 0 && buf[0] == '[' {
+		err = json.Unmarshal(buf, &sets)
+	} else {
+		sets = []*set{new(set)}
+		err = json.Unmarshal(buf, sets[0])
+	}
+	if err != nil {
+		return err
+	}
+	for i, s := range sets {
+		if s.Name == "" {
+			return fmt.Errorf("set %d has no label", i+1)
+		}
+		if s.Source == "" {
+			s.Source = source
+		}
+		label := s.Label
+		err = b.Add(&label, s.Addresses...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (b *Book) readCode(r io.Reader) error {
+	var code map[string]string
+	err := json.NewDecoder(r).Decode(&code)
+	if err != nil {
+		return err
+	}
+	for addr, hex := range code {
+		c, err := hexutil.Decode(hex)
+		if err != nil {
+			return fmt.Errorf("%s: %w", addr, err)
+		}
+		err = b.SetCode(addr, c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package addresses_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/addresses"
+)
+
+func TestChecksum(t *testing.T) {
+	cases := []struct {
+		addr              string
+		checksummed, want bool
+	}{
+		{"0x742d35Cc6634C0532925a3b844Bc454e4438f44e", true, true},
+		{"0x742d35cc6634c0532925a3b844bc454e4438f44e", false, true},
+		{"0x742D35CC6634C0532925A3B844BC454E4438F44E", false, true},
+		{"0x742d35Cc6634C0532925a3b844Bc454e4438F44e", true, false},
+	}
+	for _, c := range cases {
+		if addresses.HasChecksum(c.addr) != c.checksummed || addresses.ValidChecksum(c.addr) != c.want {
+			t.Errorf("%s: want checksummed=%v valid=%v", c.addr, c.checksummed, c.want)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	b, err := addresses.LoadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Denylisted, labelled, and a contract
+	info, err := b.Lookup("0x722122DF12D4E14E13AC3B6895A86E84145B6967")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Denylisted || info.Risk != addresses.RiskHigh || len(info.Labels) != 2 || info.AccountType != addresses.AccountContract {
+		t.Fatalf("unexpected %+v", info)
+	}
+	if info.Labels[0].Name != "gambling" && info.Labels[1].Name != "gambling" {
+		t.Fatalf("want the gambling label, got %+v", info.Labels)
+	}
+
+	// Labelled with the highest risk of its labels, and an EOA
+	info, err = b.Lookup("0x742d35cc6634c0532925a3b844bc454e4438f44e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Denylisted || info.Risk != addresses.RiskMedium || info.AccountType != addresses.AccountEOA || info.Address != "0x742d35Cc6634C0532925a3b844Bc454e4438f44e" {
+		t.Fatalf("unexpected %+v", info)
+	}
+
+	// Unknown
+	info, err = b.Lookup("0x0000000000000000000000000000000000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Denylisted || info.Risk != "" || len(info.Labels) != 0 || info.AccountType != addresses.AccountUnknown {
+		t.Fatalf("unexpected %+v", info)
+	}
+
+	// Invalid entries are rejected
+	err = addresses.NewBook().ReadDenylist(strings.NewReader("0x1234\n"), "bad")
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("want an error for an invalid address, got %v", err)
+	}
+	err = addresses.NewBook().ReadLabels(strings.NewReader(`{"label": "x", "risk": "extreme", "addresses": []}`), "bad")
+	if err == nil {
+		t.Fatal("want an error for an invalid risk")
+	}
+}
@@ -0,0 +1,277 @@
+package rules
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+// Aggregation is the policy that combines the results of the certificates of
+// an identity into the final decision.
+type Aggregation string
+
+const (
+	// AggregateAllValid allows the identity only if every certificate is
+	// allowed. The reasons of every denied certificate are reported, and the
+	// score and tier are the worst of all the certificates.
+	AggregateAllValid Aggregation = "all-valid"
+
+	// AggregateAnyValid allows the identity if any certificate is allowed. The
+	// first allowed certificate, with the primary first, decides. If none are
+	// allowed the results are combined as for [AggregateAllValid].
+	AggregateAnyValid Aggregation = "any-valid"
+
+	// AggregateHighestTier uses the result of the riskiest certificate: the
+	// one with the highest risk tier, and then the highest score. Unlike
+	// [AggregateAllValid], the decision, reasons, and score all come from
+	// that one certificate.
+	AggregateHighestTier Aggregation = "highest-tier"
+)
+
+// DefaultAggregation is used if neither the ruleset nor the request specify a
+// policy.
+const DefaultAggregation = AggregateAllValid
+
+func (a Aggregation) valid() error {
+	switch a {
+	case AggregateAllValid, AggregateAnyValid, AggregateHighestTier:
+		return nil
+	}
+	return fmt.Errorf("invalid aggregation policy %q", a)
+}
+
+// aggregation returns the aggregation policy of the request or, if it does not
+// specify one, of the ruleset.
+func (rs *Ruleset) aggregation(req *Request) Aggregation {
+	if req.Aggregation != "" {
+		return req.Aggregation
+	}
+	return rs.Aggregation
+}
+
+// IdentityCertificate is one of the certificates of an identity.
+type IdentityCertificate struct {
+	// Target is the target of the personal bank data item that refers to the
+	// certificate, such as primaryAml.
+	Target string
+	ID     [32]byte
+	Data   map[string]any
+
+	// Signers are the key pages that signed the certificate. They are only
+	// fetched if the ruleset only trusts certain issuers.
+	Signers []*Signer
+}
+
+// CertificateResult is the result of one of the certificates of an identity.
+type CertificateResult struct {
+	Target string  `json:"target"`
+	ID     string  `json:"id,omitempty"`
+	Result *Result `json:"result"`
+}
+
+// identityFields are the fields of the identity entity, which is available to
+// the decision tables while each certificate is evaluated.
+var identityFields = []string{"certificates", "certificateTargets", "certificateTarget"}
+
+// FetchAmlCerts fetches every certificate the identity's personal bank refers
+// to, the primary certificate first.
+func FetchAmlCerts(ctx context.Context, client api.Querier, identity *url.URL) ([]*IdentityCertificate, error) {
+	refs, err := FetchAmlCertIDs(ctx, client, identity)
+	if err != nil {
+		return nil, err
+	}
+	return fetchAmlCerts(ctx, client, refs)
+}
+
+func fetchAmlCerts(ctx context.Context, client api.Querier, refs []*CertificateRef) ([]*IdentityCertificate, error) {
+	certs := make([]*IdentityCertificate, len(refs))
+	for i, ref := range refs {
+		data, err := fetchAmlCertData(ctx, client, ref.ID)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s: %w", ref.Target, err)
+		}
+		certs[i] = &IdentityCertificate{Target: ref.Target, ID: ref.ID, Data: data}
+	}
+	return certs, nil
+}
+
+// EvaluateCertificates executes the request's ruleset against each of the
+// certificates of an identity and combines the results with the aggregation
+// policy of the request or, if it does not specify one, of the ruleset.
+func (e *Engine) EvaluateCertificates(ctx context.Context, req *Request, certs []*IdentityCertificate) (*Result, error) {
+	rs, err := e.Ruleset(req.Ruleset)
+	if err != nil {
+		return nil, err
+	}
+	timed := e.withTime(req)
+	history, err := e.history(ctx, nil, rs, timed, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.evaluateCertificates(ctx, rs, timed, certs, history...)
+	if err != nil {
+		return nil, err
+	}
+	return e.attest(rs, req, res)
+}
+
+// evaluateCertificates evaluates each certificate with the identity entity
+// and any other entities, and aggregates the results.
+func (e *Engine) evaluateCertificates(ctx context.Context, rs *Ruleset, req *Request, certs []*IdentityCertificate, entities ...vm.Entity) (*Result, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	policy := rs.aggregation(req)
+	err := policy.valid()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every certificate is evaluated as of the same time
+	req = e.withTime(req)
+
+	var all, targets []any
+	for _, c := range certs {
+		data, err := normalizeJSON(c.Data)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s: %w", c.Target, err)
+		}
+		all = append(all, data)
+		targets = append(targets, c.Target)
+	}
+
+	results := make([]*Result, len(certs))
+	for i, c := range certs {
+		data, err := normalizeJSON(c.Data)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s: %w", c.Target, err)
+		}
+
+		// Certificates that were not signed by a trusted issuer are denied
+		// without executing the ruleset
+		var issuer *Signer
+		if len(rs.TrustedIssuers) > 0 {
+			issuer = rs.trustedSigner(c.Signers)
+			if issuer == nil {
+				results[i] = e.untrustedResult(rs, req)
+				continue
+			}
+		}
+
+		// Each certificate is given its own copy of the identity so the tables
+		// cannot change what the next certificate sees
+		identity, err := normalizeJSON(map[string]any{
+			"certificates":       all,
+			"certificateTargets": targets,
+			"certificateTarget":  c.Target,
+		})
+		if err != nil {
+			return nil, err
+		}
+		results[i], err = e.evaluate(ctx, rs, req, NewCertificate(data), append(slices.Clip(entities), &jEntity{"identity", identity})...)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s: %w", c.Target, err)
+		}
+		results[i].Issuer = issuer
+	}
+	ids := make([][32]byte, len(certs))
+	for i, c := range certs {
+		ids[i] = c.ID
+	}
+	if len(certs) == 1 {
+		results[0].certificates = ids
+		return results[0], nil
+	}
+
+	res := aggregate(policy, results)
+	res.Aggregation = policy
+	res.certificates = ids
+	for i, c := range certs {
+		res.Certificates = append(res.Certificates, &CertificateResult{
+			Target: c.Target,
+			ID:     hex.EncodeToString(c.ID[:]),
+			Result: results[i],
+		})
+	}
+	return res, nil
+}
+
+// aggregate combines the results of the certificates according to the
+// policy. The results are in the order of the certificates.
+func aggregate(policy Aggregation, results []*Result) *Result {
+	switch policy {
+	case AggregateAnyValid:
+		for _, r := range results {
+			if !r.Denied {
+				return r.summary()
+			}
+		}
+
+	case AggregateHighestTier:
+		worst := results[0]
+		for _, r := range results[1:] {
+			if tierRank(r.RiskTier) > tierRank(worst.RiskTier) ||
+				tierRank(r.RiskTier) == tierRank(worst.RiskTier) && r.RiskScore > worst.RiskScore {
+				worst = r
+			}
+		}
+		return worst.summary()
+	}
+
+	// All valid
+	res := results[0].summary()
+	res.Denied = false
+	res.Reasons = nil
+	res.ReviewReasons = nil
+	res.SchemaViolations = nil
+	res.SanctionsHits = nil
+	res.Issuer = nil
+	var reasons []any
+	for _, r := range results {
+		res.ReviewReasons = append(res.ReviewReasons, r.ReviewReasons...)
+		res.SanctionsHits = mergeHits(res.SanctionsHits, r.SanctionsHits)
+		if r.Denied {
+			res.Denied = true
+			for _, reason := range denialReasons(r.DenialReason) {
+				reasons = append(reasons, reason)
+			}
+			res.Reasons = append(res.Reasons, r.Reasons...)
+		}
+		res.RiskScore = max(res.RiskScore, r.RiskScore)
+		if tierRank(r.RiskTier) > tierRank(res.RiskTier) {
+			res.RiskTier = r.RiskTier
+			res.RecommendedActions = r.RecommendedActions
+		}
+	}
+	if res.Denied {
+		res.DenialReason = reasons
+	}
+	return res
+}
+
+// summary returns a copy of the result to be used as the result of the
+// identity. Traces and schema violations stay with the certificate's result.
+func (r *Result) summary() *Result {
+	s := *r
+	s.Explain = nil
+	s.SchemaViolations = nil
+	return &s
+}
+
+func tierRank(t RiskTier) int {
+	switch t {
+	case RiskLow:
+		return 0
+	case RiskMedium:
+		return 1
+	case RiskHigh:
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,161 @@
+package rules_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestAggregation(t *testing.T) {
+	newCert := func(status, operation, toDate string) map[string]any {
+		return map[string]any{
+			"certificationStatus": status,
+			"dataOperationType":   operation,
+			"fromDate":            "2024-01-01",
+			"toDate":              toDate,
+		}
+	}
+	asOf := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	// A valid primary certificate and an expired business certificate
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	certs := []*rules.IdentityCertificate{
+		{Target: "primaryAml", Data: newCert("passed", "create", "2030-01-01")},
+		{Target: "businessKyb", Data: newCert("passed", "create", "2024-03-01")},
+	}
+	res, err := engine.EvaluateCertificates(ctx, &rules.Request{AsOf: &asOf}, certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied || res.Aggregation != rules.AggregateAllValid || len(res.Certificates) != 2 {
+		t.Fatalf("want denied by all-valid with two results, got %+v", res)
+	}
+	if len(res.Reasons) != 1 || res.Reasons[0].Code != "CERT_EXPIRED" || res.Certificates[1].Target != "businessKyb" {
+		t.Fatalf("want the business certificate to have expired, got %+v", res.Reasons)
+	}
+
+	res, err = engine.EvaluateCertificates(ctx, &rules.Request{AsOf: &asOf, Aggregation: rules.AggregateAnyValid}, certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Denied || len(res.Reasons) != 0 || !res.Certificates[1].Result.Denied {
+		t.Fatalf("want allowed by any-valid, got %+v", res)
+	}
+
+	// A low risk primary certificate and a high risk secondary certificate
+	certs = []*rules.IdentityCertificate{
+		{Target: "primaryAml", Data: newCert("passed", "create", "2030-01-01")},
+		{Target: "secondaryKyc", Data: newCert("pending", "update", "2030-01-01")},
+	}
+	cases := []struct {
+		config string
+		policy rules.Aggregation
+		tier   rules.RiskTier
+		score  float64
+	}{
+		{"", "", rules.RiskHigh, 80},
+		{"", rules.AggregateAnyValid, rules.RiskLow, 0},
+		{"", rules.AggregateHighestTier, rules.RiskHigh, 80},
+		{`{"aggregation": "highest-tier"}`, "", rules.RiskHigh, 80},
+		{`{"aggregation": "highest-tier"}`, rules.AggregateAnyValid, rules.RiskLow, 0},
+	}
+	for _, c := range cases {
+		engine := rules.NewEngine(must1(rules.NewRegistry(riskRuleset(t, c.config))))
+		res, err := engine.EvaluateCertificates(ctx, &rules.Request{AsOf: &asOf, Aggregation: c.policy}, certs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Denied || res.RiskTier != c.tier || res.RiskScore != c.score {
+			t.Errorf("%s %s: want %s (%v), got %s (%v)", c.config, c.policy, c.tier, c.score, res.RiskTier, res.RiskScore)
+		}
+	}
+
+	_, err = engine.EvaluateCertificates(ctx, &rules.Request{Aggregation: "most-valid"}, certs)
+	if err == nil {
+		t.Fatal("want an error for an invalid policy")
+	}
+}
+
+func TestIdentityEntity(t *testing.T) {
+	// A table that denies business certificates if the identity has fewer
+	// than three certificates
+	rs := testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>certificateTarget "businessKyb" s== certificates length 3 &lt; &amp;&amp;</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>true /denied xdef "Business certificate requires two others" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`)
+	for _, issue := range rules.Lint(rs) {
+		if issue.Kind == rules.LintUnknownName {
+			t.Fatal(issue)
+		}
+	}
+
+	cert := map[string]any{"certificationStatus": "passed", "dataOperationType": "create", "fromDate": "2024-01-01", "toDate": "2030-01-01"}
+	res, err := rules.NewEngine(must1(rules.NewRegistry(rs))).EvaluateCertificates(context.Background(), &rules.Request{}, []*rules.IdentityCertificate{
+		{Target: "primaryAml", Data: cert},
+		{Target: "businessKyb", Data: cert},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied || res.Certificates[0].Result.Denied || !res.Certificates[1].Result.Denied {
+		t.Fatalf("want only the business certificate denied, got %+v", res)
+	}
+
+	// A table that overwrites the identity does not change what the next
+	// certificate sees
+	rs = testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>certificateTargets length 2 ==</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column>
+<condition_column column_number="2" column_value="N"></condition_column></condition_details>
+</conditions>
+<actions>
+<action_details>
+<action_number>1</action_number>
+<action_postfix>"tampered" /certificateTargets xdef</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details>
+<action_details>
+<action_number>2</action_number>
+<action_postfix>true /denied xdef "The identity was modified" denialReason swap addto</action_postfix>
+<action_column column_number="2" column_value="X"></action_column></action_details>
+</actions>
+</decision_table></decision_tables>`)
+	res, err = rules.NewEngine(must1(rules.NewRegistry(rs))).EvaluateCertificates(context.Background(), &rules.Request{}, []*rules.IdentityCertificate{
+		{Target: "primaryAml", Data: cert},
+		{Target: "businessKyb", Data: cert},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Denied {
+		t.Fatalf("want each certificate to see the original identity, got %v", res.DenialReason)
+	}
+}
+
+func TestRemoteAggregation(t *testing.T) {
+	// A remote caller cannot weaken the ruleset's policy
+	var req rules.Request
+	err := json.Unmarshal([]byte(`{"aggregation": "any-valid"}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Aggregation != "" {
+		t.Fatalf("want the policy ignored, got %q", req.Aggregation)
+	}
+}
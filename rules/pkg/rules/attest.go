@@ -0,0 +1,379 @@
+package rules
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// KeyType is the type of a key that signs attestations.
+type KeyType string
+
+const (
+	KeyEd25519   KeyType = "ed25519"
+	KeySecp256k1 KeyType = "secp256k1"
+)
+
+// SigningKey is a private key that signs attestations.
+type SigningKey struct {
+	typ KeyType
+	ed  ed25519.PrivateKey
+	k1  *secp256k1.PrivateKey
+}
+
+// ParseSigningKey parses a key written as type:key, such as ed25519:<hex>. An
+// Ed25519 key is a 32-byte seed or a 64-byte private key, and a secp256k1 key
+// is a 32-byte scalar.
+func ParseSigningKey(s string) (*SigningKey, error) {
+	typ, key, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return nil, errors.New("invalid signing key: want type:key")
+	}
+	b, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+
+	switch KeyType(typ) {
+	case KeyEd25519:
+		switch len(b) {
+		case ed25519.SeedSize:
+			return &SigningKey{typ: KeyEd25519, ed: ed25519.NewKeyFromSeed(b)}, nil
+		case ed25519.PrivateKeySize:
+			return &SigningKey{typ: KeyEd25519, ed: ed25519.PrivateKey(b)}, nil
+		}
+	case KeySecp256k1:
+		var k secp256k1.ModNScalar
+		if len(b) == 32 && !k.SetByteSlice(b) && !k.IsZero() {
+			return &SigningKey{typ: KeySecp256k1, k1: secp256k1.NewPrivateKey(&k)}, nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid signing key: unknown type %q", typ)
+	}
+	return nil, fmt.Errorf("invalid %s signing key", typ)
+}
+
+// LoadSigningKey reads a key from a file, in the format of
+// [ParseSigningKey].
+func LoadSigningKey(file string) (*SigningKey, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSigningKey(string(b))
+}
+
+// Type returns the type of the key.
+func (k *SigningKey) Type() KeyType { return k.typ }
+
+// PublicKey returns the public key: 32 bytes for Ed25519 and a compressed
+// point for secp256k1.
+func (k *SigningKey) PublicKey() []byte {
+	if k.typ == KeyEd25519 {
+		return k.ed.Public().(ed25519.PublicKey)
+	}
+	return k.k1.PubKey().SerializeCompressed()
+}
+
+// sign signs a hash. A secp256k1 signature is R and S, 32 bytes each.
+func (k *SigningKey) sign(hash []byte) []byte {
+	if k.typ == KeyEd25519 {
+		return ed25519.Sign(k.ed, hash)
+	}
+	return ecdsa.SignCompact(k.k1, hash, true)[1:]
+}
+
+// verify checks the signature of a hash by a public key. A secp256k1
+// signature must have a low S.
+func verify(typ KeyType, pub, hash, sig []byte) error {
+	switch typ {
+	case KeyEd25519:
+		if len(pub) != ed25519.PublicKeySize {
+			return errors.New("invalid public key")
+		}
+		if !ed25519.Verify(pub, hash, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+
+	case KeySecp256k1:
+		key, err := secp256k1.ParsePubKey(pub)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		var r, s secp256k1.ModNScalar
+		if len(sig) != 64 || r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) {
+			return errors.New("invalid signature")
+		}
+
+		// Both S and -S verify, so only the low one is accepted, as it is by
+		// Ethereum, or a signature would have two valid encodings
+		if s.IsOverHalfOrder() {
+			return errors.New("invalid signature: S is not canonical")
+		}
+		if !ecdsa.NewSignature(&r, &s).Verify(hash, key) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown key type %q", typ)
+}
+
+// Statement is the part of a decision that an attestation signs.
+type Statement struct {
+	// Identity is the identity that was screened or, for a transaction, the
+	// sender.
+	Identity    string       `json:"identity,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+
+	Denied   bool     `json:"denied"`
+	RiskTier RiskTier `json:"riskTier"`
+
+	// Reasons are the codes of the denial reasons.
+	Reasons []string `json:"reasons"`
+
+	// Ruleset is the hash of the ruleset that made the decision.
+	Ruleset string `json:"ruleset"`
+
+	// Certificates are the hashes of the certificate entries the decision is
+	// based on.
+	Certificates []string `json:"certificates"`
+
+	// Aggregation is the policy that combined the results of the identity's
+	// certificates, or of each party's.
+	Aggregation Aggregation `json:"aggregation"`
+
+	// AsOf is the time the certificates were evaluated at, Time is when the
+	// decision was signed, and ExpiresAt is when it stops being valid.
+	AsOf      time.Time `json:"asOf"`
+	Time      time.Time `json:"time"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Replay is the past moment whose entries were evaluated, if the request
+	// replayed one.
+	Replay *Moment `json:"replay,omitempty"`
+
+	// Live is true if the decision is of the latest entries as of the time it
+	// was signed, under the ruleset's own aggregation policy. A request that
+	// sets the time, replays a moment, or overrides the policy produces a
+	// decision that is not live, which must not be relied on as a current
+	// decision.
+	Live bool `json:"live"`
+
+	// Nonce is 32 random bytes, as hex, that make each decision unique so a
+	// verifier can refuse to accept it twice. UserOpHash is the request's.
+	Nonce      string `json:"nonce"`
+	UserOpHash string `json:"userOpHash,omitempty"`
+}
+
+// DefaultDecisionLifetime is how long a signed decision is valid for if the
+// engine's lifetime is never set.
+const DefaultDecisionLifetime = 5 * time.Minute
+
+// Attestation is a signed statement of a decision, which anyone with the
+// signer's public key can verify offline. The signature covers the SHA-256
+// hash of the statement's JSON without insignificant whitespace, exactly as
+// it appears in the attestation.
+type Attestation struct {
+	Statement json.RawMessage `json:"statement"`
+	KeyType   KeyType         `json:"keyType"`
+	PublicKey string          `json:"publicKey"`
+	Signature string          `json:"signature"`
+}
+
+// Attest signs a statement.
+func Attest(key *SigningKey, s *Statement) (*Attestation, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(b)
+	return &Attestation{
+		Statement: b,
+		KeyType:   key.typ,
+		PublicKey: hex.EncodeToString(key.PublicKey()),
+		Signature: hex.EncodeToString(key.sign(hash[:])),
+	}, nil
+}
+
+// VerifyAttestation checks the signature of an attestation and returns its
+// statement. If any public keys are given, the attestation must be signed by
+// one of them; otherwise the caller must check the attestation's key.
+func VerifyAttestation(a *Attestation, trusted ...[]byte) (*Statement, error) {
+	pub, err := hex.DecodeString(a.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	sig, err := hex.DecodeString(a.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if len(trusted) > 0 && !containsKey(trusted, pub) {
+		return nil, fmt.Errorf("attestation was signed by %x, which is not trusted", pub)
+	}
+
+	var b bytes.Buffer
+	err = json.Compact(&b, a.Statement)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statement: %w", err)
+	}
+	hash := sha256.Sum256(b.Bytes())
+	err = verify(a.KeyType, pub, hash[:], sig)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(Statement)
+	err = json.Unmarshal(b.Bytes(), s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statement: %w", err)
+	}
+	return s, nil
+}
+
+// ParseAttestation decodes an attestation, or a result and returns its
+// attestation.
+func ParseAttestation(b []byte) (*Attestation, error) {
+	a := new(Attestation)
+	err := json.Unmarshal(b, a)
+	if err != nil {
+		return nil, err
+	}
+	if a.Statement != nil {
+		return a, nil
+	}
+
+	var res struct {
+		Attestation *Attestation `json:"attestation"`
+	}
+	err = json.Unmarshal(b, &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Attestation == nil {
+		return nil, errors.New("not an attestation or a result with one")
+	}
+	return res.Attestation, nil
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// statement returns the statement of a result. The request is the one the
+// caller made, before the engine set its time.
+func (e *Engine) statement(rs *Ruleset, req *Request, res *Result) (*Statement, error) {
+	if req.UserOpHash != "" {
+		_, err := parseHash(strings.TrimPrefix(req.UserOpHash, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("user operation hash: %w", err)
+		}
+	}
+	var nonce [32]byte
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.Clock().Now().UTC()
+	s := &Statement{
+		Transaction:  req.Transaction,
+		Denied:       res.Denied,
+		RiskTier:     res.RiskTier,
+		Reasons:      []string{},
+		Certificates: []string{},
+		Aggregation:  rs.aggregation(req),
+		AsOf:         res.AsOf,
+		Time:         now,
+		ExpiresAt:    now.Add(e.DecisionLifetime()),
+		Replay:       req.Replay,
+		Live:         req.AsOf == nil && req.Replay == nil && req.Aggregation == "",
+		Nonce:        hex.EncodeToString(nonce[:]),
+		UserOpHash:   req.UserOpHash,
+	}
+	switch {
+	case req.Identity != nil:
+		s.Identity = req.Identity.String()
+	case req.Transaction != nil && req.Transaction.Sender != nil:
+		s.Identity = req.Transaction.Sender.String()
+	}
+	for _, r := range res.Reasons {
+		s.Reasons = append(s.Reasons, r.Code)
+	}
+	if res.Ruleset != nil {
+		s.Ruleset = res.Ruleset.Hash
+	}
+	for _, id := range res.certificates {
+		if id != ([32]byte{}) {
+			s.Certificates = append(s.Certificates, hex.EncodeToString(id[:]))
+		}
+	}
+	return s, nil
+}
+
+// attest signs the result, if the engine has a signing key, and signs it as
+// an EIP-712 decision if the engine has a domain.
+func (e *Engine) attest(rs *Ruleset, req *Request, res *Result) (*Result, error) {
+	key := e.SigningKey()
+	if key == nil {
+		return res, nil
+	}
+	s, err := e.statement(rs, req, res)
+	if err != nil {
+		return nil, err
+	}
+	res.Attestation, err = Attest(key, s)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := e.Eip712Domain()
+	if domain == nil {
+		return res, nil
+	}
+	d, err := NewAmlDecision(s)
+	if err != nil {
+		return nil, err
+	}
+	res.Eip712, err = SignTypedDecision(key, domain, d)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SetSigningKey sets the key that signs every result. If it is never set,
+// results are not signed.
+func (e *Engine) SetSigningKey(k *SigningKey) { e.signingKey.Store(k) }
+
+// SigningKey returns the signing key, or nil.
+func (e *Engine) SigningKey() *SigningKey { return e.signingKey.Load() }
+
+// SetDecisionLifetime sets how long a signed decision is valid for after it
+// is signed. If it is never set, decisions are valid for
+// [DefaultDecisionLifetime].
+func (e *Engine) SetDecisionLifetime(d time.Duration) { e.lifetime.Store(&d) }
+
+// DecisionLifetime returns how long a signed decision is valid for.
+func (e *Engine) DecisionLifetime() time.Duration {
+	if d := e.lifetime.Load(); d != nil {
+		return *d
+	}
+	return DefaultDecisionLifetime
+}
@@ -0,0 +1,143 @@
+package rules_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+func TestAttestation(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cert := []*rules.IdentityCertificate{{Target: "primaryAml", ID: [32]byte{1, 2, 3}, Data: map[string]any{
+		"certificationStatus": "failed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	}}}
+
+	for _, typ := range []rules.KeyType{rules.KeyEd25519, rules.KeySecp256k1} {
+		t.Run(string(typ), func(t *testing.T) {
+			key := must1(rules.ParseSigningKey(string(typ) + ":" + strings.Repeat("01", 32)))
+			engine := rules.NewEngine(rules.DefaultRegistry())
+			engine.SetClock(rules.FixedClock(now))
+			engine.SetSigningKey(key)
+
+			res, err := engine.EvaluateCertificates(context.Background(), &rules.Request{Identity: url.MustParse("alice.acme")}, cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Attestation == nil {
+				t.Fatal("want an attestation")
+			}
+
+			// The attestation survives being re-encoded with the result
+			b := must1(json.MarshalIndent(res, "", "  "))
+			a := must1(rules.ParseAttestation(b))
+			s, err := rules.VerifyAttestation(a, key.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &rules.Statement{
+				Identity:     "acc://alice.acme",
+				Denied:       true,
+				RiskTier:     rules.RiskProhibited,
+				Reasons:      []string{"CERT_FAILED"},
+				Ruleset:      fmt.Sprintf("%x", rules.DefaultRuleset().Hash),
+				Certificates: []string{fmt.Sprintf("%x", cert[0].ID)},
+				Aggregation:  rules.AggregateAllValid,
+				AsOf:         now,
+				Time:         now,
+				Live:         true,
+			}
+			if !slices.Equal(s.Reasons, want.Reasons) || !slices.Equal(s.Certificates, want.Certificates) ||
+				s.Identity != want.Identity || s.Denied != want.Denied || s.RiskTier != want.RiskTier ||
+				s.Ruleset != want.Ruleset || s.Aggregation != want.Aggregation || s.Replay != nil || s.Live != want.Live ||
+				!s.AsOf.Equal(want.AsOf) || !s.Time.Equal(want.Time) {
+				t.Fatalf("want %+v, got %+v", want, s)
+			}
+
+			// A request that sets the time or overrides the policy is signed
+			// as not live, with the policy that was applied
+			for _, c := range []struct {
+				req    *rules.Request
+				policy rules.Aggregation
+			}{
+				{&rules.Request{Identity: url.MustParse("alice.acme"), AsOf: &now}, rules.AggregateAllValid},
+				{&rules.Request{Identity: url.MustParse("alice.acme"), Aggregation: rules.AggregateAnyValid}, rules.AggregateAnyValid},
+			} {
+				res := must1(engine.EvaluateCertificates(context.Background(), c.req, cert))
+				s := must1(rules.VerifyAttestation(res.Attestation, key.PublicKey()))
+				if s.Live || s.Aggregation != c.policy {
+					t.Fatalf("want a decision with %s that is not live, got %+v", c.policy, s)
+				}
+			}
+
+			// A secp256k1 signature with a high S is rejected even though it
+			// is valid, so a signature has only one encoding
+			if typ == rules.KeySecp256k1 {
+				high := *a
+				sig := must1(hex.DecodeString(a.Signature))
+				var s secp256k1.ModNScalar
+				s.SetByteSlice(sig[32:])
+				b := s.Negate().Bytes()
+				high.Signature = hex.EncodeToString(append(sig[:32:32], b[:]...))
+				_, err = rules.VerifyAttestation(&high)
+				if err == nil || !strings.Contains(err.Error(), "not canonical") {
+					t.Fatalf("want a non-canonical signature, got %v", err)
+				}
+			}
+
+			// A different key is not trusted
+			_, err = rules.VerifyAttestation(a, bytes.Repeat([]byte{2}, len(key.PublicKey())))
+			if err == nil || !strings.Contains(err.Error(), "not trusted") {
+				t.Fatalf("want an untrusted key, got %v", err)
+			}
+
+			// Changing the decision invalidates the signature
+			a.Statement = bytes.Replace(a.Statement, []byte(`"denied": true`), []byte(`"denied": false`), 1)
+			_, err = rules.VerifyAttestation(a)
+			if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+				t.Fatalf("want an invalid signature, got %v", err)
+			}
+		})
+	}
+
+	// Results are not signed without a key
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	res, err := engine.EvaluateCertificates(context.Background(), &rules.Request{AsOf: &now}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Attestation != nil {
+		t.Fatalf("want no attestation, got %+v", res.Attestation)
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	for _, s := range []string{
+		"ed25519",
+		"ed25519:zz",
+		"ed25519:0102",
+		"rsa:" + strings.Repeat("01", 32),
+		"secp256k1:" + strings.Repeat("00", 32),
+		"secp256k1:" + strings.Repeat("ff", 32),
+	} {
+		if _, err := rules.ParseSigningKey(s); err == nil {
+			t.Fatalf("want an error for %q", s)
+		}
+	}
+	key := must1(rules.ParseSigningKey("secp256k1:" + strings.Repeat("01", 32) + "\n"))
+	if len(key.PublicKey()) != 33 {
+		t.Fatalf("want a compressed public key, got %x", key.PublicKey())
+	}
+}
@@ -0,0 +1,245 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+)
+
+// ViolationKind is the kind of problem found by [ValidateCertificate].
+type ViolationKind string
+
+const (
+	// ViolationMissing is a required field that is absent or null.
+	ViolationMissing ViolationKind = "missing"
+
+	// ViolationWrongType is a field whose value cannot be converted to the
+	// type declared by the EDD.
+	ViolationWrongType ViolationKind = "wrong-type"
+)
+
+// SchemaViolation is a certificate field that does not match the EDD.
+type SchemaViolation struct {
+	Field   string        `json:"field"`
+	Kind    ViolationKind `json:"kind"`
+	Want    string        `json:"want,omitempty"`
+	Got     string        `json:"got,omitempty"`
+	Message string        `json:"message"`
+}
+
+func (v *SchemaViolation) String() string { return v.Message }
+
+func (v *SchemaViolation) reason() *Reason {
+	switch v.Kind {
+	case ViolationMissing:
+		return &Reason{Code: "CERT_FIELD_MISSING", Params: map[string]any{"field": v.Field}}
+	default:
+		return &Reason{Code: "CERT_FIELD_WRONG_TYPE", Params: map[string]any{"field": v.Field, "want": v.Want, "got": v.Got}}
+	}
+}
+
+// ValidateCertificate builds the certificate entity from the ruleset's EDD,
+// converting each field to its declared type. Strings that hold a number or
+// boolean are converted to that type and numbers are converted to strings;
+// anything else that does not match is a violation. Fields the tables convert
+// to dates with cvd must hold a date the cvd operator can parse; JSON numbers
+// in those fields are Unix timestamps. Fields that
+// are not declared by the EDD, and entity fields such as the self reference,
+// are not set. If the EDD does not define a certificate, the data is used as
+// is.
+//
+// A field is required if the EDD marks it as required or if it is an input,
+// that is a read-only field with no default value other than the mapping key.
+// A required field that is null or an empty string is missing.
+func ValidateCertificate(rs *Ruleset, data map[string]any) (vm.Entity, []*SchemaViolation) {
+	def, ok := rs.Entities["certificate"]
+	if !ok {
+		return NewCertificate(data), nil
+	}
+
+	// Match fields case-insensitively, as the VM does
+	values := make(map[string]any, len(data))
+	for k, v := range data {
+		values[strings.ToLower(k)] = v
+	}
+
+	cert := def.New("certificate")
+	var violations []*SchemaViolation
+	for _, name := range sortedKeys(def) {
+		f := def[name]
+		if f.Type == dt.EntityType {
+			continue
+		}
+		v, ok := values[strings.ToLower(name)]
+		blank := ok && isBlank(v)
+		if !ok || v == nil || blank && isRequired(name, f) {
+			if isRequired(name, f) {
+				violations = append(violations, &SchemaViolation{
+					Field:   name,
+					Kind:    ViolationMissing,
+					Message: fmt.Sprintf("Certificate field %s is missing", name),
+				})
+			}
+			continue
+		}
+
+		date := rs.dates[strings.ToLower(name)]
+		u, ok := coerce(f.Type, v)
+		if n, isNum := v.(float64); isNum && date && f.Type == vm.StringType {
+			// cvd parses every string as a formatted date, so convert Unix
+			// timestamps to one
+			u = unixDate(n).Format(time.RFC3339Nano)
+		}
+		if ok {
+			ok = cert.Set(name, u) == nil
+		}
+		if !ok {
+			want, got := typeName(f.Type), jsonTypeName(v)
+			violations = append(violations, &SchemaViolation{
+				Field:   name,
+				Kind:    ViolationWrongType,
+				Want:    want,
+				Got:     got,
+				Message: fmt.Sprintf("Certificate field %s has the wrong type: want %s, got %s", name, want, got),
+			})
+			continue
+		}
+
+		if s, ok := u.(string); ok && !blank && date {
+			if _, err := parseDate(strings.TrimSpace(s)); err != nil {
+				got := fmt.Sprintf("%q", s)
+				violations = append(violations, &SchemaViolation{
+					Field:   name,
+					Kind:    ViolationWrongType,
+					Want:    "date",
+					Got:     got,
+					Message: fmt.Sprintf("Certificate field %s has the wrong type: want date, got %s", name, got),
+				})
+			}
+		}
+	}
+	return cert, violations
+}
+
+func isBlank(v any) bool {
+	s, ok := v.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// dateFields returns the names, in lower case, of the fields the tables
+// convert to dates, that is fields that are immediately followed by cvd.
+func dateFields(tables vm.Entity) map[string]bool {
+	dates := map[string]bool{}
+	_ = forEachTable(tables, func(_ string, table *dt.DecisionTable) error {
+		for _, stmts := range [][]vm.Value{table.Before, table.Conditions, table.Actions} {
+			for _, stmt := range stmts {
+				var prev string
+				walkStatement(stmt, func(v vm.Value) {
+					var name string
+					switch v := v.(type) {
+					case vm.ExecutableName:
+						name = v.Name()
+					case vm.CompoundName:
+						if v.Executable {
+							name = v.Member.Name()
+						}
+					}
+					if strings.EqualFold(name, "cvd") && prev != "" {
+						dates[strings.ToLower(prev)] = true
+					}
+					prev = name
+				})
+			}
+		}
+		return nil
+	})
+	return dates
+}
+
+func isRequired(name string, f dt.EntityDefinitionField) bool {
+	if f.Required {
+		return true
+	}
+	if f.Writable || name == "mapping*key" {
+		return false
+	}
+	return f.Default == nil || f.Default.Type() == vm.NullType
+}
+
+// coerce converts a decoded JSON value to the declared type.
+func coerce(typ vm.Type, v any) (any, bool) {
+	switch typ {
+	case vm.StringType:
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		}
+
+	case vm.NumberType:
+		switch v := v.(type) {
+		case float64:
+			return v, true
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f, err == nil
+		}
+
+	case vm.BooleanType:
+		switch v := v.(type) {
+		case bool:
+			return v, true
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			return b, err == nil
+		}
+
+	case vm.ArrayType:
+		if v, ok := v.([]any); ok {
+			a, err := j2vm("", v)
+			return a, err == nil
+		}
+
+	case vm.NullType:
+		return v, true
+	}
+	return nil, false
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// violationResult is the result for a certificate that does not match the
+// EDD. The ruleset is not executed.
+func violationResult(rs *Ruleset, violations []*SchemaViolation) *Result {
+	reasons := make([]any, len(violations))
+	for i, v := range violations {
+		reasons[i] = v.Message
+	}
+	return &Result{
+		Denied:             true,
+		DenialReason:       reasons,
+		RiskTier:           RiskProhibited,
+		RecommendedActions: []string{ActionDeny},
+		SchemaViolations:   violations,
+		Ruleset:            rs.ref(),
+	}
+}
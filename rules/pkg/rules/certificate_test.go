@@ -0,0 +1,40 @@
+package rules_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestMalformedCertificate(t *testing.T) {
+	cert := rules.NewCertificate(map[string]any{
+		"certificationStatus": true,
+		"dataOperationType":   "create",
+		"fromDate":            1704067200.0,
+		"toDate":              nil,
+		"extra":               "ignored",
+	})
+	res, err := rules.NewEngine(rules.DefaultRegistry()).Evaluate(context.Background(), &rules.Request{}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied {
+		t.Fatal("want a malformed certificate to be denied")
+	}
+
+	var got []string
+	for _, v := range res.SchemaViolations {
+		got = append(got, v.Field+": "+string(v.Kind))
+	}
+	want := []string{"certificationStatus: wrong-type", "toDate: missing"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("want violations %q, got %q", want, got)
+	}
+
+	reasons, _ := res.DenialReason.([]any)
+	if len(reasons) != 2 || reasons[0] != "Certificate field certificationStatus has the wrong type: want string, got boolean" {
+		t.Fatalf("want a denial reason for each violation, got %v", res.DenialReason)
+	}
+}
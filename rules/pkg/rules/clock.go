@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"context"
+	"time"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+	lxml "github.com/C3Rules/Go-DTRules/pkg/legacy/xml"
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+)
+
+// Clock provides the time a request is evaluated at, which getDate returns.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a [Clock] that returns the current time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// FixedClock is a [Clock] that always returns the same time.
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time { return time.Time(c) }
+
+// SetClock replaces the clock used for requests that do not specify a time.
+// If it is never set, the engine uses [SystemClock].
+func (e *Engine) SetClock(c Clock) { e.clock.Store(&c) }
+
+// Clock returns the engine's clock.
+func (e *Engine) Clock() Clock {
+	if c := e.clock.Load(); c != nil {
+		return *c
+	}
+	return SystemClock{}
+}
+
+type evaluationTimeKey struct{}
+
+// withEvaluationTime returns a context that causes getDate to return the
+// given time. The engine reads its clock once per request, so every getDate
+// in a request returns the same time.
+func withEvaluationTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, evaluationTimeKey{}, t)
+}
+
+func evaluationTime(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(evaluationTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// opGetDate replaces the VM's getDate, which always returns the current time,
+// so that the time can be controlled by the caller.
+type opGetDate struct{}
+
+func (opGetDate) Type() vm.Type  { return vm.NameType }
+func (opGetDate) String() string { return "getDate" }
+
+func (opGetDate) Execute(s vm.State) error {
+	return s.Data().Push(must1(vm.AsValue(evaluationTime(s.Context()))))
+}
+
+// rebindGetDate replaces every getDate in the compiled tables with
+// [opGetDate]. The VM binds built-in operators when a table is compiled, so
+// they cannot be overridden by name.
+func rebindGetDate(tables vm.Entity) {
+	t, ok := tables.(lxml.TablesEntity)
+	if !ok {
+		return
+	}
+	for _, v := range t {
+		if named, ok := v.Value.(*vm.Named); ok {
+			rebindValue(named.Value)
+		}
+	}
+}
+
+func rebindValue(v vm.Value) {
+	switch v := v.(type) {
+	case *dt.DecisionTable:
+		for _, stmts := range [][]vm.Value{v.Before, v.Conditions, v.Actions} {
+			for _, stmt := range stmts {
+				rebindValue(stmt)
+			}
+		}
+
+	case *vm.ExecutableArray:
+		rebindArray(*v)
+
+	case *vm.LiteralArray:
+		rebindArray(*v)
+	}
+}
+
+func rebindArray(a []vm.Value) {
+	for i, u := range a {
+		if _, ok := u.(vm.Name); !ok && u.Type() == vm.NameType && u.String() == "getDate" {
+			a[i] = opGetDate{}
+			continue
+		}
+		rebindValue(u)
+	}
+}
@@ -0,0 +1,53 @@
+package rules_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestClock(t *testing.T) {
+	newCert := func() map[string]any {
+		return map[string]any{
+			"certificationStatus": "passed",
+			"dataOperationType":   "create",
+			"fromDate":            "2024-01-01",
+			"toDate":              "2025-01-01",
+		}
+	}
+	valid := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	expired := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	engine.SetClock(rules.FixedClock(valid))
+	ctx := context.Background()
+
+	// The engine's clock is used by default
+	res, err := engine.Evaluate(ctx, &rules.Request{}, rules.NewCertificate(newCert()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Denied || !res.AsOf.Equal(valid) {
+		t.Fatalf("want allowed as of %v, got denied=%v as of %v", valid, res.Denied, res.AsOf)
+	}
+
+	// The request's time takes precedence
+	res, err = engine.Evaluate(ctx, &rules.Request{AsOf: &expired}, rules.NewCertificate(newCert()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied || !res.AsOf.Equal(expired) {
+		t.Fatalf("want denied as of %v, got denied=%v as of %v", expired, res.Denied, res.AsOf)
+	}
+
+	// Replaying a decision as of its recorded time reproduces it
+	again, err := rules.NewEngine(rules.DefaultRegistry()).Evaluate(ctx, &rules.Request{AsOf: &res.AsOf}, rules.NewCertificate(newCert()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Denied != res.Denied || again.Reasons[0].Code != res.Reasons[0].Code {
+		t.Fatalf("want the replay to match, got %+v", again)
+	}
+}
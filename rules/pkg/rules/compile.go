@@ -0,0 +1,457 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/xls"
+)
+
+// CompileWorkbooks compiles the entity data dictionary and decision table
+// workbooks into the XML loaded by [LoadRuleset]. The compiled rules are
+// checked the same way they are when a ruleset is loaded, so compilation fails
+// on a postfix syntax error or a misused operator.
+func CompileWorkbooks(eddPath, dtPath string) (eddXml, dtXml []byte, err error) {
+	edd, err := xls.Open(eddPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", eddPath, err)
+	}
+	dt, err := xls.Open(dtPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", dtPath, err)
+	}
+
+	eddXml, err = CompileEDDWorkbook(edd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", eddPath, err)
+	}
+	dtXml, err = CompileDTWorkbook(dt, filepath.Base(dtPath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", dtPath, err)
+	}
+
+	_, _, _, err = compileTables(eddXml, dtXml)
+	if err != nil {
+		return nil, nil, err
+	}
+	return eddXml, dtXml, nil
+}
+
+var eddTypes = []string{"entity", "integer", "string", "array", "boolean"}
+
+// CompileEDDWorkbook compiles an entity data dictionary workbook. Each sheet
+// has a header row naming the columns, including Entity, Attribute, Type, and
+// optionally SubType, Default Value, Input, Access, Required, and Comment,
+// followed by one row per field.
+func CompileEDDWorkbook(w *xls.Workbook) ([]byte, error) {
+	type field struct{ name, typ, subtype, access, input, def, required, comment string }
+	entities := map[string][]*field{}
+	for _, sheet := range w.Sheets {
+		if len(sheet.Rows) == 0 {
+			continue
+		}
+
+		cols := map[string]int{}
+		for i, h := range sheet.Rows[0] {
+			cols[strings.ToLower(strings.Join(strings.Fields(h), " "))] = i
+		}
+		get := func(row int, name string) string {
+			i, ok := cols[name]
+			if !ok {
+				return ""
+			}
+			return strings.TrimSpace(sheet.Cell(row, i))
+		}
+		for _, name := range []string{"entity", "attribute", "type"} {
+			if _, ok := cols[name]; !ok {
+				return nil, fmt.Errorf("sheet %s: missing %s column", sheet.Name, name)
+			}
+		}
+
+		for row := 1; row < len(sheet.Rows); row++ {
+			f := &field{
+				name:     get(row, "attribute"),
+				typ:      strings.ToLower(get(row, "type")),
+				subtype:  get(row, "subtype"),
+				access:   get(row, "access"),
+				input:    get(row, "input"),
+				def:      get(row, "default value"),
+				required: get(row, "required"),
+				comment:  get(row, "comment"),
+			}
+			entity := strings.ToLower(get(row, "entity"))
+			if entity == "" && f.name == "" {
+				continue
+			}
+			if entity == "" || f.name == "" || f.typ == "" {
+				return nil, fmt.Errorf("sheet %s row %d: entity, attribute, and type are required", sheet.Name, row+1)
+			}
+			if !slices.Contains(eddTypes, f.typ) {
+				return nil, fmt.Errorf("sheet %s row %d: unknown type %q", sheet.Name, row+1, f.typ)
+			}
+
+			if f.def == "" {
+				switch f.typ {
+				case "boolean":
+					f.def = "false"
+				case "array":
+					f.def = "[]"
+				}
+			}
+			if _, err := vm.ParseValueString(f.def); f.def != "" && err != nil {
+				return nil, fmt.Errorf("sheet %s row %d: invalid default value: %w", sheet.Name, row+1, err)
+			}
+			entities[entity] = append(entities[entity], f)
+		}
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("no entities found")
+	}
+
+	// Every entity has a reference to itself and a mapping key
+	var buf bytes.Buffer
+	buf.WriteString("<entity_data_dictionary version='2' xmlns:xs='http://www.w3.org/2001/XMLSchema'>\n")
+	for _, name := range sortedKeys(entities) {
+		fields := append(entities[name],
+			&field{name: name, typ: "entity", access: "r", comment: "Self Reference"},
+			&field{name: "mapping*key", typ: "string", access: "r", comment: "Mapping Key"})
+		slices.SortStableFunc(fields, func(a, b *field) int {
+			return strings.Compare(strings.ToLower(a.name), strings.ToLower(b.name))
+		})
+
+		fmt.Fprintf(&buf, "\t<entity name='%s' access='rw' comment=''>\n", xmlEscape(name))
+		for i, f := range fields {
+			if i > 0 && strings.EqualFold(f.name, fields[i-1].name) {
+				return nil, fmt.Errorf("entity %s: duplicate field %s", name, f.name)
+			}
+			fmt.Fprintf(&buf, "\t\t<field name='%s' type='%s' subtype='%s' access='%s'", xmlEscape(f.name), xmlEscape(f.typ), xmlEscape(f.subtype), xmlEscape(f.access))
+			if f.required != "" {
+				fmt.Fprintf(&buf, " required='%s'", xmlEscape(f.required))
+			}
+			fmt.Fprintf(&buf, " input='%s' default_value='%s' comment='%s'></field>\n", xmlEscape(f.input), xmlEscape(f.def), xmlEscape(f.comment))
+		}
+		buf.WriteString("\t</entity>\n")
+	}
+	buf.WriteString("</entity_data_dictionary>\n")
+	return buf.Bytes(), nil
+}
+
+// CompileDTWorkbook compiles a decision table workbook. A sheet may contain
+// any number of tables, each of which starts with a NAME: row, followed by
+// TYPE:, COMMENTS:, and POLICY REFERENCE: rows and CONTEXTS:, INITIAL
+// ACTIONS:, CONDITIONS:, and ACTIONS: sections. In each section, column A is
+// the number, column B is the postfix, column C is the description, and the
+// remaining columns are the cases. If the postfix is empty it is translated
+// from the description; see [TranslateCondition] and [TranslateAction]. The
+// source is recorded as the file each table was compiled from.
+func CompileDTWorkbook(w *xls.Workbook, source string) ([]byte, error) {
+	var tables []*wbTable
+	for _, sheet := range w.Sheets {
+		t, err := parseDTSheet(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", sheet.Name, err)
+		}
+		tables = append(tables, t...)
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no decision tables found")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<decision_tables>\n")
+	for i, t := range tables {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		t.write(&buf, source)
+	}
+	buf.WriteString("</decision_tables>")
+	return buf.Bytes(), nil
+}
+
+type wbTable struct {
+	name, typ, comments, policy string
+
+	contexts, initial, conditions, actions []*wbStatement
+}
+
+type wbStatement struct {
+	number      int
+	description string
+	postfix     string
+	columns     []wbColumn
+}
+
+type wbColumn struct {
+	number int
+	value  string
+}
+
+var dtSections = map[string]string{
+	"CONTEXTS":          "contexts",
+	"INITIAL ACTIONS":   "initial",
+	"CONDITIONS":        "conditions",
+	"ACTIONS":           "actions",
+	"POLICY STATEMENTS": "policy",
+}
+
+func parseDTSheet(sheet *xls.Sheet) ([]*wbTable, error) {
+	var tables []*wbTable
+	var t *wbTable
+	var section string
+	for row := range sheet.Rows {
+		a := strings.TrimSpace(sheet.Cell(row, 0))
+		key, value, isAttr := strings.Cut(a, ":")
+		key = strings.ToUpper(strings.Join(strings.Fields(key), " "))
+		value = strings.TrimSpace(value)
+
+		switch {
+		case a == "" && strings.TrimSpace(sheet.Cell(row, 2)) == "":
+			// A blank row ends a section
+			section = ""
+			continue
+
+		case isAttr && key == "NAME":
+			t = &wbTable{name: strings.Join(strings.Fields(value), "_"), typ: "FIRST"}
+			tables = append(tables, t)
+			section = ""
+			continue
+
+		case t == nil:
+			continue
+
+		case isAttr && key == "TYPE":
+			t.typ = strings.ToUpper(value)
+			if t.typ != "FIRST" && t.typ != "ALL" {
+				return nil, fmt.Errorf("table %s: invalid type %q", t.name, value)
+			}
+			continue
+
+		case isAttr && key == "COMMENTS":
+			t.comments = value
+			continue
+
+		case isAttr && key == "POLICY REFERENCE":
+			t.policy = value
+			continue
+
+		case isAttr && dtSections[key] != "":
+			section = dtSections[key]
+			continue
+		}
+
+		s, err := parseDTRow(sheet, row, section)
+		if err != nil {
+			return nil, fmt.Errorf("table %s %s: %w", t.name, cellRef(row, 0), err)
+		}
+		switch section {
+		case "contexts":
+			t.contexts = append(t.contexts, s)
+		case "initial":
+			t.initial = append(t.initial, s)
+		case "conditions":
+			t.conditions = append(t.conditions, s)
+		case "actions":
+			t.actions = append(t.actions, s)
+		}
+	}
+
+	for _, t := range tables {
+		if len(t.conditions) == 0 && len(t.actions) == 0 {
+			return nil, fmt.Errorf("table %s has no conditions or actions", t.name)
+		}
+	}
+	return tables, nil
+}
+
+func parseDTRow(sheet *xls.Sheet, row int, section string) (*wbStatement, error) {
+	s := &wbStatement{
+		postfix:     strings.Join(strings.Fields(sheet.Cell(row, 1)), " "),
+		description: strings.Join(strings.Fields(sheet.Cell(row, 2)), " "),
+	}
+	if n := strings.TrimSpace(sheet.Cell(row, 0)); n != "" {
+		var err error
+		s.number, err = strconv.Atoi(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", n)
+		}
+	}
+
+	if s.postfix == "" {
+		var err error
+		switch section {
+		case "conditions":
+			s.postfix, err = TranslateCondition(s.description)
+		case "contexts", "initial", "actions":
+			s.postfix, err = TranslateAction(s.description)
+		default:
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := vm.CompileString(s.postfix); err != nil {
+		return nil, fmt.Errorf("invalid postfix %q: %w", s.postfix, err)
+	}
+
+	if section != "conditions" && section != "actions" {
+		return s, nil
+	}
+	for col := 3; col < len(sheet.Rows[row]); col++ {
+		v := strings.ToUpper(strings.TrimSpace(sheet.Cell(row, col)))
+		switch {
+		case v == "" || v == "-":
+			continue
+		case section == "conditions" && (v == "Y" || v == "N" || v == "*"):
+		case section == "actions" && v == "X":
+		default:
+			return nil, fmt.Errorf("%s: invalid value %q", cellRef(row, col), v)
+		}
+		s.columns = append(s.columns, wbColumn{col - 2, v})
+	}
+	return s, nil
+}
+
+func (t *wbTable) write(buf *bytes.Buffer, source string) {
+	fmt.Fprintf(buf, "<decision_table>\n<table_name>%s</table_name>\n<xls_file>%s</xls_file>\n", xmlEscape(t.name), xmlEscape(source))
+	fmt.Fprintf(buf, "<attribute_fields>\n<TYPE>%s</TYPE>\n<COMMENTS>%s</COMMENTS>\n<POLICY_REFERENCE>%s</POLICY_REFERENCE></attribute_fields>\n", t.typ, xmlEscape(t.comments), xmlEscape(t.policy))
+
+	section := func(name, item string, stmts []*wbStatement, withColumns bool) {
+		fmt.Fprintf(buf, "<%s>", name)
+		for i, s := range stmts {
+			number := s.number
+			if number == 0 {
+				number = i + 1
+			}
+			fmt.Fprintf(buf, "\n<%[1]s_details>\n<%[1]s_number>%[2]d</%[1]s_number>\n<%[1]s_comment></%[1]s_comment>\n", item, number)
+			if item != "context" {
+				fmt.Fprintf(buf, "<%[1]s_requirement></%[1]s_requirement>\n", item)
+			}
+			fmt.Fprintf(buf, "<%[1]s_description>%[2]s</%[1]s_description>\n<%[1]s_postfix>\n%[3]s\n</%[1]s_postfix>\n", item, xmlEscape(s.description), xmlEscape(s.postfix))
+			if withColumns {
+				for _, c := range s.columns {
+					fmt.Fprintf(buf, "<%s_column column_number=\"%d\" column_value=\"%s\"></%[1]s_column>", item, c.number, c.value)
+				}
+			}
+			fmt.Fprintf(buf, "</%s_details>", item)
+		}
+		fmt.Fprintf(buf, "</%s>\n", name)
+	}
+	section("contexts", "context", t.contexts, false)
+	section("initial_actions", "initial_action", t.initial, false)
+	section("conditions", "condition", t.conditions, true)
+	section("actions", "action", t.actions, true)
+	buf.WriteString("<policy_statements></policy_statements></decision_table>")
+}
+
+type phrase struct {
+	pattern  *regexp.Regexp
+	template string
+}
+
+func phrases(p ...string) []phrase {
+	var out []phrase
+	for i := 0; i < len(p); i += 2 {
+		out = append(out, phrase{regexp.MustCompile(`(?i)^` + p[i] + `$`), p[i+1]})
+	}
+	return out
+}
+
+const (
+	phraseName   = `([A-Za-z_][\w.]*)`
+	phraseString = `"([^"]*)"`
+	phraseNumber = `(-?\d+(?:\.\d+)?)`
+)
+
+var conditionPhrases = phrases(
+	phraseName+` is equal to ignore case `+phraseString, `$1 "$2" sic==`,
+	phraseName+` is not equal to ignore case `+phraseString, `$1 "$2" sic== not`,
+	phraseName+` is equal to `+phraseString, `$1 "$2" s==`,
+	phraseName+` is not equal to `+phraseString, `$1 "$2" s== not`,
+	phraseName+` is equal to `+phraseNumber, `$1 $2 ==`,
+	phraseName+` is greater than `+phraseNumber, `$1 $2 >`,
+	phraseName+` is less than `+phraseNumber, `$1 $2 <`,
+	phraseName+` is true`, `$1`,
+	phraseName+` is false`, `$1 not`,
+	`date\(`+phraseName+`\) is greater than the current date`, `$1 cvd getdate d>`,
+	`date\(`+phraseName+`\) is less than the current date`, `$1 cvd getdate d<`,
+	`date\(`+phraseName+`\) is greater than date\(`+phraseName+`\)`, `$1 cvd $2 cvd d>`,
+	`date\(`+phraseName+`\) is less than date\(`+phraseName+`\)`, `$1 cvd $2 cvd d<`,
+)
+
+var actionPhrases = phrases(
+	`set `+phraseName+` = (true|false)`, `$2 cvb /$1 xdef`,
+	`set `+phraseName+` = `+phraseString, `"$2" /$1 xdef`,
+	`set `+phraseName+` = `+phraseNumber, `$2 /$1 xdef`,
+	`add `+phraseString+` to `+phraseName, `"$1" $2 swap addto`,
+	`add `+phraseNumber+` to `+phraseName, `$2 $1 + /$2 xdef`,
+	`(?:execute|perform) `+phraseName, `$1`,
+)
+
+// TranslateCondition translates the description of a condition written in the
+// phrasing used by the decision table workbooks, such as `fromDate is equal to
+// "x"`, to postfix.
+func TranslateCondition(description string) (string, error) {
+	return translate(conditionPhrases, description)
+}
+
+// TranslateAction translates the description of an action to postfix. An
+// action may consist of several statements separated by semicolons, such as
+// `set denied = true; add "reason" to denialReason`.
+func TranslateAction(description string) (string, error) {
+	var out []string
+	for _, s := range strings.Split(description, ";") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		p, err := translate(actionPhrases, s)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, p)
+	}
+	return strings.Join(out, "  "), nil
+}
+
+func translate(phrases []phrase, s string) (string, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return "", fmt.Errorf("empty description")
+	}
+	for _, p := range phrases {
+		m := p.pattern.FindStringSubmatchIndex(s)
+		if m != nil {
+			return string(p.pattern.ExpandString(nil, p.template, s, m)), nil
+		}
+	}
+	return "", fmt.Errorf("cannot translate %q: use a known phrase or provide the postfix", s)
+}
+
+func cellRef(row, col int) string {
+	var s string
+	for col++; col > 0; col = (col - 1) / 26 {
+		s = string(rune('A'+(col-1)%26)) + s
+	}
+	return s + strconv.Itoa(row+1)
+}
+
+var xmlEscaper = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;", `'`, "&apos;")
+
+func xmlEscape(s string) string { return xmlEscaper.Replace(s) }
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package rules_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/xls"
+)
+
+// TestCompileWorkbooks verifies the compiled rules are up to date with the
+// workbooks. Run go generate to update them.
+func TestCompileWorkbooks(t *testing.T) {
+	edd, dt, err := rules.CompileWorkbooks("edd.xls", "dt.xls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, got := range map[string][]byte{"compiled_edd.xml": edd, "compiled_dt.xml": dt} {
+		want, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("%s is out of date", file)
+		}
+	}
+}
+
+func TestCompileDTWorkbookErrors(t *testing.T) {
+	cases := map[string]struct {
+		row   []string
+		error string
+	}{
+		"unknown phrase": {[]string{"1", "", "certificationStatus is somewhat failed", "Y"}, "cannot translate"},
+		"syntax error":   {[]string{"1", `certificationStatus "failed sic==`, "", "Y"}, "invalid postfix"},
+		"invalid case":   {[]string{"1", "", `certificationStatus is equal to "failed"`, "X"}, "invalid value"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := &xls.Workbook{Sheets: []*xls.Sheet{{Name: "Sheet1", Rows: [][]string{
+				{"NAME: Validate Certificate"},
+				{"TYPE: FIRST"},
+				{},
+				{"CONDITIONS:", "", "CONDITIONS", "1"},
+				c.row,
+				{},
+				{"ACTIONS:", "", "ACTIONS", "1"},
+				{"1", "", "set denied = true", "X"},
+			}}}}
+			_, err := rules.CompileDTWorkbook(w, "dt.xls")
+			if err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Fatalf("want error containing %q, got %v", c.error, err)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	cases := map[string]string{
+		`dataOperationType is equal to ignore case "delete"`: `dataOperationType "delete" sic==`,
+		`date(toDate) is less than the current date`:         `toDate cvd getdate d<`,
+	}
+	for description, want := range cases {
+		got, err := rules.TranslateCondition(description)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+
+	got, err := rules.TranslateAction(`set denied = true; add "Certificate has expired" to denialReason`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `true cvb /denied xdef  "Certificate has expired" denialReason swap addto`; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	got, err = rules.TranslateAction(`add 25 to riskScore`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `riskScore 25 + /riskScore xdef`; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
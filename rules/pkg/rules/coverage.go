@@ -0,0 +1,221 @@
+package rules
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+)
+
+// Coverage accumulates which cases, conditions, and actions of the decision
+// tables were exercised across many executions. Attach it to an engine with
+// [Engine.CollectCoverage]. Coverage is safe for concurrent use.
+type Coverage struct {
+	mu     sync.Mutex
+	tables map[[2]string]*TableCoverage
+}
+
+// CoverageReport is a snapshot of [Coverage], ordered by ruleset and table.
+type CoverageReport struct {
+	Tables []*TableCoverage `json:"tables"`
+}
+
+// TableCoverage is the coverage of a decision table. Numbers are one-based,
+// and case numbers are the case's column in the source.
+type TableCoverage struct {
+	Ruleset    string               `json:"ruleset"`
+	Table      string               `json:"table"`
+	Executions int                  `json:"executions"`
+	Cases      []*CaseCoverage      `json:"cases"`
+	Conditions []*ConditionCoverage `json:"conditions"`
+	Actions    []*ActionCoverage    `json:"actions"`
+}
+
+type CaseCoverage struct {
+	Number int `json:"number"`
+	Fired  int `json:"fired"`
+}
+
+// ConditionCoverage counts the results of a condition. A condition that
+// evaluated to null is counted as false, as that is how the table treats it.
+type ConditionCoverage struct {
+	Number  int    `json:"number"`
+	Postfix string `json:"postfix"`
+	True    int    `json:"true"`
+	False   int    `json:"false"`
+}
+
+type ActionCoverage struct {
+	Number  int    `json:"number"`
+	Postfix string `json:"postfix"`
+	Runs    int    `json:"runs"`
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{tables: map[[2]string]*TableCoverage{}}
+}
+
+// CollectCoverage records the coverage of every execution into c. Pass nil
+// to stop collecting.
+func (e *Engine) CollectCoverage(c *Coverage) { e.coverage.Store(c) }
+
+// add records an execution. Every table of the ruleset is included in the
+// coverage, even if it was not executed.
+func (c *Coverage) add(rs *Ruleset, ex *Explanation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_ = forEachTable(rs.Tables, func(name string, table *dt.DecisionTable) error {
+		key := [2]string{rs.Name, name}
+		if _, ok := c.tables[key]; ok {
+			return nil
+		}
+		t := &TableCoverage{Ruleset: rs.Name, Table: name}
+		for i := range table.Cases {
+			t.Cases = append(t.Cases, &CaseCoverage{Number: rs.caseNumber(name, i)})
+		}
+		for i, v := range table.Conditions {
+			t.Conditions = append(t.Conditions, &ConditionCoverage{Number: i + 1, Postfix: v.String()})
+		}
+		for i, v := range table.Actions {
+			t.Actions = append(t.Actions, &ActionCoverage{Number: i + 1, Postfix: v.String()})
+		}
+		c.tables[key] = t
+		return nil
+	})
+
+	c.addTables(rs.Name, ex.Tables)
+}
+
+func (c *Coverage) addTables(ruleset string, tables []*TableTrace) {
+	for _, trace := range tables {
+		t, ok := c.tables[[2]string{ruleset, trace.Name}]
+		if !ok {
+			continue
+		}
+		t.Executions++
+		for _, cond := range trace.Conditions {
+			if cond.Number < 1 || cond.Number > len(t.Conditions) {
+				continue
+			}
+			if cond.Result == true {
+				t.Conditions[cond.Number-1].True++
+			} else {
+				t.Conditions[cond.Number-1].False++
+			}
+		}
+		for _, kase := range trace.Cases {
+			i := slices.IndexFunc(t.Cases, func(c *CaseCoverage) bool { return c.Number == kase.Number })
+			if i >= 0 {
+				t.Cases[i].Fired++
+			}
+			for _, action := range kase.Actions {
+				if action.Number >= 1 && action.Number <= len(t.Actions) {
+					t.Actions[action.Number-1].Runs++
+				}
+				c.addTables(ruleset, action.Tables)
+			}
+		}
+	}
+}
+
+// Report returns a snapshot of the coverage.
+func (c *Coverage) Report() *CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := new(CoverageReport)
+	for _, t := range c.tables {
+		u := *t
+		u.Cases = cloneAll(t.Cases)
+		u.Conditions = cloneAll(t.Conditions)
+		u.Actions = cloneAll(t.Actions)
+		r.Tables = append(r.Tables, &u)
+	}
+	sort.Slice(r.Tables, func(i, j int) bool {
+		a, b := r.Tables[i], r.Tables[j]
+		if a.Ruleset != b.Ruleset {
+			return a.Ruleset < b.Ruleset
+		}
+		return a.Table < b.Table
+	})
+	return r
+}
+
+// Complete returns true if every case fired, every condition was both true
+// and false, and every action ran.
+func (t *TableCoverage) Complete() bool {
+	fired, branched, ran := t.counts()
+	return fired == len(t.Cases) && branched == len(t.Conditions) && ran == len(t.Actions)
+}
+
+func (t *TableCoverage) counts() (fired, branched, ran int) {
+	for _, c := range t.Cases {
+		if c.Fired > 0 {
+			fired++
+		}
+	}
+	for _, c := range t.Conditions {
+		if c.True > 0 && c.False > 0 {
+			branched++
+		}
+	}
+	for _, a := range t.Actions {
+		if a.Runs > 0 {
+			ran++
+		}
+	}
+	return
+}
+
+// WriteText writes the report in a human readable form, listing the cases,
+// conditions, and actions that were not covered.
+func (r *CoverageReport) WriteText(w io.Writer) error {
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	for _, t := range r.Tables {
+		fired, branched, ran := t.counts()
+		printf("%s/%s (executed %d times)\n", t.Ruleset, t.Table, t.Executions)
+		printf("  cases       %d/%d fired\n", fired, len(t.Cases))
+		for _, c := range t.Cases {
+			if c.Fired == 0 {
+				printf("    case %d never fired\n", c.Number)
+			}
+		}
+		printf("  conditions  %d/%d evaluated true and false\n", branched, len(t.Conditions))
+		for _, c := range t.Conditions {
+			switch {
+			case c.True == 0 && c.False == 0:
+				printf("    condition %d was never evaluated: %s\n", c.Number, c.Postfix)
+			case c.True == 0:
+				printf("    condition %d was never true: %s\n", c.Number, c.Postfix)
+			case c.False == 0:
+				printf("    condition %d was never false: %s\n", c.Number, c.Postfix)
+			}
+		}
+		printf("  actions     %d/%d ran\n", ran, len(t.Actions))
+		for _, a := range t.Actions {
+			if a.Runs == 0 {
+				printf("    action %d never ran: %s\n", a.Number, a.Postfix)
+			}
+		}
+	}
+	return err
+}
+
+func cloneAll[V any](s []*V) []*V {
+	out := make([]*V, len(s))
+	for i, v := range s {
+		u := *v
+		out[i] = &u
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package rules_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestCoverage(t *testing.T) {
+	// The fixtures must exercise every path of the built-in rules
+	fixtures := must1(rules.LoadFixtures(os.DirFS("testdata/fixtures")))
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	coverage := rules.NewCoverage()
+	engine.CollectCoverage(coverage)
+	var executed int
+	for _, r := range engine.RunFixtures(context.Background(), fixtures) {
+		if !r.Passed() {
+			t.Fatalf("%s: %v", r.Fixture.Name, r.Failures)
+		}
+
+		// Certificates that do not match the EDD are denied without executing
+		// the tables
+		if len(r.Result.SchemaViolations) == 0 {
+			executed++
+		}
+	}
+
+	report := coverage.Report()
+	if len(report.Tables) != 1 {
+		t.Fatalf("want 1 table, got %d", len(report.Tables))
+	}
+	table := report.Tables[0]
+	if table.Table != "Validate_Certificate" || table.Executions != executed {
+		t.Fatalf("want Validate_Certificate executed %d times, got %s executed %d times", executed, table.Table, table.Executions)
+	}
+	if !table.Complete() {
+		buf := new(bytes.Buffer)
+		_ = report.WriteText(buf)
+		t.Fatalf("want complete coverage, got\n%s", buf)
+	}
+}
+
+func TestCoverageIncomplete(t *testing.T) {
+	fixtures := must1(rules.LoadFixtures(fstest.MapFS{
+		"valid.yaml": {Data: []byte(`
+asOf: 2024-06-01T00:00:00Z
+certificate:
+  certificationStatus: passed
+  dataOperationType: create
+  fromDate: 2024-01-01
+  toDate: 2025-01-01
+`)},
+	}))
+
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	coverage := rules.NewCoverage()
+	engine.CollectCoverage(coverage)
+	engine.RunFixtures(context.Background(), fixtures)
+
+	// Collection stops when the coverage is detached
+	engine.CollectCoverage(nil)
+	engine.RunFixtures(context.Background(), fixtures)
+
+	report := coverage.Report()
+	table := report.Tables[0]
+	if table.Complete() || table.Executions != 1 {
+		t.Fatalf("want incomplete coverage from 1 execution, got %d executions", table.Executions)
+	}
+	for _, c := range table.Conditions {
+		if c.True != 0 || c.False != 1 {
+			t.Errorf("condition %d: want 0 true and 1 false, got %d and %d", c.Number, c.True, c.False)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := report.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"cases       1/5 fired", "case 1 never fired", "condition 2 was never true", "action 4 never ran"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want report to contain %q, got\n%s", want, buf)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+)
+
+// dateOperators are the legacy DTRules date operators. The VM only provides
+// newDate and the dt comparisons, but decision tables written for DTRules use
+// cvd to convert a value to a date and d<, d>, etc to compare dates.
+var dateOperators = []Operator{
+	{Name: "cvd", Args: []vm.Type{AnyType}, Results: []vm.Type{vm.DateTimeType}, Fn: opCvd},
+	dateCompare("d<", func(x, y time.Time) bool { return x.Before(y) }),
+	dateCompare("d>", func(x, y time.Time) bool { return x.After(y) }),
+	dateCompare("d<=", func(x, y time.Time) bool { return !x.After(y) }),
+	dateCompare("d>=", func(x, y time.Time) bool { return !x.Before(y) }),
+	dateCompare("d==", func(x, y time.Time) bool { return x.Equal(y) }),
+	dateCompare("d!=", func(x, y time.Time) bool { return !x.Equal(y) }),
+}
+
+// dateLayouts are the date formats certificate issuers are known to write.
+// Values without a time zone are interpreted as UTC.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	time.DateTime,
+	time.DateOnly,
+	"20060102",
+	"2006/01/02",
+	"2006/01/02 15:04:05",
+	"01/02/2006",
+	"01/02/2006 15:04:05",
+	"1/2/2006",
+	"1/2/2006 15:04:05",
+	"02-Jan-2006",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+// opCvd converts the top of the stack to a date. Null and empty strings
+// convert to null. Numbers are Unix timestamps in seconds, or in milliseconds
+// if they are too large to be seconds. Strings are parsed using
+// [dateLayouts], even if they look like numbers, so 20240601 is June 1st and
+// not 1970; any other string is an error, so a certificate with a malformed
+// date fails instead of silently passing the checks.
+func opCvd(s vm.State) error {
+	v, err := s.Data().Pop(1)
+	if err != nil {
+		return err
+	}
+	t, ok, err := toDate(v[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.Data().Push(vm.Null)
+	}
+	return s.Data().Push(must1(vm.AsValue(t)))
+}
+
+// dateCompare returns an operator that converts the top two values of the
+// stack to dates and compares them. If either is null the result is null.
+func dateCompare(name string, cmp func(x, y time.Time) bool) Operator {
+	op := Operator{Name: name, Args: []vm.Type{AnyType, AnyType}, Results: []vm.Type{vm.BooleanType}}
+	op.Fn = func(s vm.State) error {
+		v, err := s.Data().Pop(2)
+		if err != nil {
+			return err
+		}
+		x, okx, err := toDate(v[0])
+		if err != nil {
+			return err
+		}
+		y, oky, err := toDate(v[1])
+		if err != nil {
+			return err
+		}
+		if !okx || !oky {
+			return s.Data().Push(vm.Null)
+		}
+		if cmp(x, y) {
+			return s.Data().Push(vm.True)
+		}
+		return s.Data().Push(vm.False)
+	}
+	return op
+}
+
+func toDate(v vm.Value) (time.Time, bool, error) {
+	switch v.Type() {
+	case vm.NullType:
+		return time.Time{}, false, nil
+
+	case vm.DateTimeType:
+		t, err := vm.AsDateTime(v)
+		return t, err == nil, err
+
+	case vm.NumberType:
+		f, err := vm.AsFloat(v)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return unixDate(f), true, nil
+	}
+
+	str := strings.TrimSpace(v.String())
+	if str == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := parseDate(str)
+	return t, err == nil, err
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a valid date", s)
+}
+
+func unixDate(f float64) time.Time {
+	// Anything past the year 5000 in seconds is assumed to be milliseconds
+	if math.Abs(f) > 1e11 {
+		return time.UnixMilli(int64(f)).UTC()
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
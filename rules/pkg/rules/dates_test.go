@@ -0,0 +1,79 @@
+package rules_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestCertificateDates(t *testing.T) {
+	now := time.Now().UTC()
+	past := now.AddDate(-1, 0, 0)
+	future := now.AddDate(1, 0, 0)
+
+	cases := map[string]struct {
+		from, to any
+		denied   bool
+		reason   []any
+	}{
+		"valid":            {past.Format(time.RFC3339), future.Format(time.RFC3339), false, []any{}},
+		"not yet active":   {future.Format(time.RFC3339), future.AddDate(1, 0, 0).Format(time.RFC3339), true, []any{"Certificate is not yet active"}},
+		"expired":          {past.AddDate(-1, 0, 0).Format(time.RFC3339), past.Format(time.RFC3339), true, []any{"Certificate has expired"}},
+		"date only":        {past.Format(time.DateOnly), future.Format(time.DateOnly), false, []any{}},
+		"milliseconds":     {past.Format("2006-01-02T15:04:05.000Z"), future.Format("2006-01-02T15:04:05.000Z"), false, []any{}},
+		"US style":         {past.Format("01/02/2006"), past.Format("01/02/2006"), true, []any{"Certificate has expired"}},
+		"compact":          {past.Format("20060102"), future.Format("20060102"), false, []any{}},
+		"compact expired":  {"20240601", "20240602", true, []any{"Certificate has expired"}},
+		"unix seconds":     {float64(past.Unix()), float64(future.Unix()), false, []any{}},
+		"unix millis":      {float64(future.UnixMilli()), float64(future.UnixMilli()), true, []any{"Certificate is not yet active"}},
+		"no dates":         {"", "", true, []any{"Certificate field fromDate is missing", "Certificate field toDate is missing"}},
+		"expired, no from": {" ", past.Format(time.RFC3339), true, []any{"Certificate field fromDate is missing"}},
+	}
+
+	// Use one engine for every case to verify executions do not share state
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cert := rules.NewCertificate(map[string]any{
+				"certificationStatus": "passed",
+				"dataOperationType":   "create",
+				"fromDate":            c.from,
+				"toDate":              c.to,
+			})
+			res, err := engine.Evaluate(context.Background(), &rules.Request{}, cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Denied != c.denied {
+				t.Fatalf("want denied=%v, got %v", c.denied, res.Denied)
+			}
+			reason, _ := res.DenialReason.([]any)
+			if fmt.Sprint(reason) != fmt.Sprint(c.reason) {
+				t.Fatalf("want reasons %v, got %v", c.reason, res.DenialReason)
+			}
+		})
+	}
+}
+
+func TestCertificateInvalidDate(t *testing.T) {
+	cert := rules.NewCertificate(map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "the first of May",
+		"toDate":              "2999-01-01",
+	})
+	res, err := rules.NewEngine(rules.DefaultRegistry()).Evaluate(context.Background(), &rules.Request{}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied || len(res.SchemaViolations) != 1 {
+		t.Fatalf("want one schema violation, got %+v", res.SchemaViolations)
+	}
+	v := res.SchemaViolations[0]
+	if v.Field != "fromDate" || v.Kind != rules.ViolationWrongType || v.Want != "date" || v.Got != `"the first of May"` {
+		t.Fatalf("want an invalid fromDate, got %+v", v)
+	}
+}
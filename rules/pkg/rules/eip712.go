@@ -0,0 +1,488 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"golang.org/x/crypto/sha3"
+)
+
+// Eip712Domain is the EIP-712 domain of a decision, which binds its signature
+// to a chain and to the contract that checks it.
+type Eip712Domain struct {
+	Name              string         `json:"name"`
+	Version           string         `json:"version"`
+	ChainID           uint64         `json:"chainId"`
+	VerifyingContract common.Address `json:"verifyingContract"`
+}
+
+// The name and version of the EIP-712 domain of decisions.
+const (
+	Eip712Name    = "AcmeAML"
+	Eip712Version = "1"
+)
+
+// CitreaTestnet is the domain of the AcmeEntryPoint deployment on the Citrea
+// testnet.
+var CitreaTestnet = &Eip712Domain{
+	Name:              Eip712Name,
+	Version:           Eip712Version,
+	ChainID:           5115,
+	VerifyingContract: common.HexToAddress("0xC618bc721900094549Ec35191e335B4B84Cf9E21"),
+}
+
+// Eip712Field is a member of an EIP-712 struct type.
+type Eip712Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// eip712Types are the types of a decision, in the format of
+// eth_signTypedData_v4.
+var eip712Types = map[string][]Eip712Field{
+	"EIP712Domain": {
+		{"name", "string"},
+		{"version", "string"},
+		{"chainId", "uint256"},
+		{"verifyingContract", "address"},
+	},
+	"AmlDecision": {
+		{"identity", "bytes32"},
+		{"recipient", "address"},
+		{"recipientIdentity", "bytes32"},
+		{"token", "address"},
+		{"amount", "uint256"},
+		{"denied", "bool"},
+		{"riskTier", "uint8"},
+		{"reasons", "bytes32"},
+		{"ruleset", "bytes32"},
+		{"certificates", "bytes32"},
+		{"aggregation", "uint8"},
+		{"asOf", "uint64"},
+		{"issuedAt", "uint64"},
+		{"expiresAt", "uint64"},
+		{"replayTime", "uint64"},
+		{"replayHeight", "uint64"},
+		{"live", "bool"},
+		{"nonce", "bytes32"},
+		{"userOpHash", "bytes32"},
+	},
+}
+
+var (
+	domainTypeHash   = keccak([]byte(eip712TypeString("EIP712Domain")))
+	decisionTypeHash = keccak([]byte(eip712TypeString("AmlDecision")))
+)
+
+func eip712TypeString(name string) string {
+	var fields []string
+	for _, f := range eip712Types[name] {
+		fields = append(fields, f.Type+" "+f.Name)
+	}
+	return name + "(" + strings.Join(fields, ",") + ")"
+}
+
+// Separator returns the domain separator.
+func (d *Eip712Domain) Separator() common.Hash {
+	return keccak(
+		domainTypeHash[:],
+		keccak([]byte(d.Name)).Bytes(),
+		keccak([]byte(d.Version)).Bytes(),
+		uintWord(d.ChainID),
+		common.LeftPadBytes(d.VerifyingContract[:], 32),
+	)
+}
+
+// AmlDecision is a decision as an EIP-712 struct. Every member is static, so
+// its ABI encoding is the EIP-712 encoding of its data, and a contract
+// computes its hash as keccak256(abi.encodePacked(TYPEHASH, abi.encode(d))).
+type AmlDecision struct {
+	// Identity is the keccak256 hash of the identity's URL or, for a
+	// transaction, of the sender's.
+	Identity common.Hash `json:"identity"`
+
+	// Recipient, Token, and Amount are the transfer's, and the amount is in
+	// the token's base units. If the recipient is an ADI, Recipient is zero
+	// and RecipientIdentity is the keccak256 hash of its URL; otherwise
+	// RecipientIdentity is zero.
+	Recipient         common.Address        `json:"recipient"`
+	RecipientIdentity common.Hash           `json:"recipientIdentity"`
+	Token             common.Address        `json:"token"`
+	Amount            *math.HexOrDecimal256 `json:"amount"`
+
+	// RiskTier is 0 for low, 1 for medium, 2 for high, and 3 for prohibited.
+	Denied   bool  `json:"denied"`
+	RiskTier uint8 `json:"riskTier"`
+
+	// Reasons is the keccak256 hash of the keccak256 hashes of the reason
+	// codes, and Certificates of the hashes of the certificate entries, as
+	// EIP-712 encodes string[] and bytes32[].
+	Reasons      common.Hash `json:"reasons"`
+	Ruleset      common.Hash `json:"ruleset"`
+	Certificates common.Hash `json:"certificates"`
+
+	// Aggregation is 0 for all-valid, 1 for any-valid, and 2 for
+	// highest-tier.
+	Aggregation uint8 `json:"aggregation"`
+
+	// AsOf, IssuedAt, and ExpiresAt are Unix times in seconds. A contract
+	// must reject a decision after it expires.
+	AsOf      uint64 `json:"asOf"`
+	IssuedAt  uint64 `json:"issuedAt"`
+	ExpiresAt uint64 `json:"expiresAt"`
+
+	// ReplayTime and ReplayHeight are the moment a replayed decision was
+	// evaluated at, as a Unix time and a block height, or zero. Live is false
+	// if the request replayed a moment, set the time, or overrode the
+	// aggregation policy, so a contract should require it.
+	ReplayTime   uint64 `json:"replayTime"`
+	ReplayHeight uint64 `json:"replayHeight"`
+	Live         bool   `json:"live"`
+
+	// Nonce is unique to the decision, so a contract can accept it once.
+	// UserOpHash is the hash of the UserOperation the decision is for, or
+	// zero if the request did not give one.
+	Nonce      common.Hash `json:"nonce"`
+	UserOpHash common.Hash `json:"userOpHash"`
+}
+
+// aggregations are the aggregation policies in the order of their EIP-712
+// encoding.
+var aggregations = []Aggregation{AggregateAllValid, AggregateAnyValid, AggregateHighestTier}
+
+// NewAmlDecision converts a statement to an EIP-712 decision. A transaction's
+// amount must be an integer in the token's base units.
+func NewAmlDecision(s *Statement) (*AmlDecision, error) {
+	d := &AmlDecision{
+		Identity:  keccak([]byte(s.Identity)),
+		Amount:    (*math.HexOrDecimal256)(new(big.Int)),
+		Denied:    s.Denied,
+		RiskTier:  uint8(tierRank(s.RiskTier)),
+		AsOf:      uint64(s.AsOf.Unix()),
+		IssuedAt:  uint64(s.Time.Unix()),
+		ExpiresAt: uint64(s.ExpiresAt.Unix()),
+		Live:      s.Live,
+	}
+	i := slices.Index(aggregations, s.Aggregation)
+	if i < 0 {
+		return nil, fmt.Errorf("invalid aggregation policy %q", s.Aggregation)
+	}
+	d.Aggregation = uint8(i)
+	if m := s.Replay; m != nil {
+		if m.Time != nil {
+			d.ReplayTime = uint64(m.Time.Unix())
+		}
+		if m.Height != nil {
+			d.ReplayHeight = *m.Height
+		}
+	}
+	if tx := s.Transaction; tx != nil {
+		recipient, err := tx.recipient()
+		switch {
+		case err != nil:
+			return nil, err
+		case recipient == nil:
+			d.Recipient = common.HexToAddress(tx.Recipient)
+		default:
+			d.RecipientIdentity = keccak([]byte(recipient.String()))
+		}
+		if tx.Token != "" {
+			if !common.IsHexAddress(tx.Token) {
+				return nil, fmt.Errorf("invalid token address %q", tx.Token)
+			}
+			d.Token = common.HexToAddress(tx.Token)
+		}
+		amount, err := tx.amount()
+		if err != nil {
+			return nil, err
+		}
+		d.Amount = (*math.HexOrDecimal256)(amount)
+	}
+
+	var reasons [][]byte
+	for _, r := range s.Reasons {
+		reasons = append(reasons, keccak([]byte(r)).Bytes())
+	}
+	d.Reasons = keccak(reasons...)
+
+	ruleset, err := hex.DecodeString(s.Ruleset)
+	if err != nil || len(ruleset) != 32 {
+		return nil, fmt.Errorf("invalid ruleset hash %q", s.Ruleset)
+	}
+	d.Ruleset = common.Hash(ruleset)
+
+	var certs [][]byte
+	for _, c := range s.Certificates {
+		b, err := hex.DecodeString(c)
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("invalid certificate hash %q", c)
+		}
+		certs = append(certs, b)
+	}
+	d.Certificates = keccak(certs...)
+
+	d.Nonce, err = parseHash(s.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	if s.UserOpHash != "" {
+		d.UserOpHash, err = parseHash(strings.TrimPrefix(s.UserOpHash, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("user operation hash: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// Encode returns the ABI encoding of the decision.
+func (d *AmlDecision) Encode() []byte {
+	var denied, live uint64
+	if d.Denied {
+		denied = 1
+	}
+	if d.Live {
+		live = 1
+	}
+	amount := new(big.Int)
+	if d.Amount != nil {
+		amount = (*big.Int)(d.Amount)
+	}
+	return bytes.Join([][]byte{
+		d.Identity[:],
+		common.LeftPadBytes(d.Recipient[:], 32),
+		d.RecipientIdentity[:],
+		common.LeftPadBytes(d.Token[:], 32),
+		math.U256Bytes(new(big.Int).Set(amount)),
+		uintWord(denied),
+		uintWord(uint64(d.RiskTier)),
+		d.Reasons[:],
+		d.Ruleset[:],
+		d.Certificates[:],
+		uintWord(uint64(d.Aggregation)),
+		uintWord(d.AsOf),
+		uintWord(d.IssuedAt),
+		uintWord(d.ExpiresAt),
+		uintWord(d.ReplayTime),
+		uintWord(d.ReplayHeight),
+		uintWord(live),
+		d.Nonce[:],
+		d.UserOpHash[:],
+	}, nil)
+}
+
+// DecodeAmlDecision decodes the ABI encoding of a decision.
+func DecodeAmlDecision(b []byte) (*AmlDecision, error) {
+	fields := eip712Types["AmlDecision"]
+	if len(b) != 32*len(fields) {
+		return nil, fmt.Errorf("invalid decision: want %d bytes, got %d", 32*len(fields), len(b))
+	}
+
+	// Each member is right-aligned in its word and the rest must be zero
+	var err error
+	word := func(i, size int) []byte {
+		w := b[32*i : 32*(i+1)]
+		if err == nil && !isZero(w[:32-size]) {
+			err = fmt.Errorf("invalid decision: %s is out of range", fields[i].Name)
+		}
+		return w[32-size:]
+	}
+	boolean := func(i int) bool {
+		v := word(i, 1)[0]
+		if err == nil && v > 1 {
+			err = fmt.Errorf("invalid decision: %s is not a boolean", fields[i].Name)
+		}
+		return v == 1
+	}
+	d := &AmlDecision{
+		Identity:          common.Hash(word(0, 32)),
+		Recipient:         common.Address(word(1, 20)),
+		RecipientIdentity: common.Hash(word(2, 32)),
+		Token:             common.Address(word(3, 20)),
+		Amount:            (*math.HexOrDecimal256)(new(big.Int).SetBytes(word(4, 32))),
+		Denied:            boolean(5),
+		RiskTier:          word(6, 1)[0],
+		Reasons:           common.Hash(word(7, 32)),
+		Ruleset:           common.Hash(word(8, 32)),
+		Certificates:      common.Hash(word(9, 32)),
+		Aggregation:       word(10, 1)[0],
+		AsOf:              binary.BigEndian.Uint64(word(11, 8)),
+		IssuedAt:          binary.BigEndian.Uint64(word(12, 8)),
+		ExpiresAt:         binary.BigEndian.Uint64(word(13, 8)),
+		ReplayTime:        binary.BigEndian.Uint64(word(14, 8)),
+		ReplayHeight:      binary.BigEndian.Uint64(word(15, 8)),
+		Live:              boolean(16),
+		Nonce:             common.Hash(word(17, 32)),
+		UserOpHash:        common.Hash(word(18, 32)),
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int(d.Aggregation) >= len(aggregations) {
+		return nil, errors.New("invalid decision: aggregation is out of range")
+	}
+	return d, nil
+}
+
+// CheckTime returns an error if the decision is not valid at the time: if it
+// was issued after the time or expired before it.
+func (d *AmlDecision) CheckTime(at time.Time) error {
+	t := uint64(at.Unix())
+	switch {
+	case t < d.IssuedAt:
+		return fmt.Errorf("decision was issued at %d, after %d", d.IssuedAt, t)
+	case t > d.ExpiresAt:
+		return fmt.Errorf("decision expired at %d, before %d", d.ExpiresAt, t)
+	}
+	return nil
+}
+
+// Hash returns the EIP-712 hash of the decision's struct.
+func (d *AmlDecision) Hash() common.Hash {
+	return keccak(decisionTypeHash[:], d.Encode())
+}
+
+// Digest returns the EIP-712 digest of the decision in the domain, which is
+// what is signed.
+func (d *AmlDecision) Digest(domain *Eip712Domain) common.Hash {
+	sep, hash := domain.Separator(), d.Hash()
+	return keccak([]byte{0x19, 0x01}, sep[:], hash[:])
+}
+
+// TypedDecision is a signed decision as EIP-712 typed data, in the format of
+// eth_signTypedData_v4, with its ABI encoding, digest, and signature. The
+// signature is R, S, and V (27 or 28), as ecrecover expects.
+type TypedDecision struct {
+	Types       map[string][]Eip712Field `json:"types"`
+	PrimaryType string                   `json:"primaryType"`
+	Domain      *Eip712Domain            `json:"domain"`
+	Message     *AmlDecision             `json:"message"`
+
+	Encoded   hexutil.Bytes  `json:"encoded"`
+	Digest    common.Hash    `json:"digest"`
+	Signature hexutil.Bytes  `json:"signature"`
+	Signer    common.Address `json:"signer"`
+}
+
+// SignTypedDecision signs a decision in the domain with a secp256k1 key.
+func SignTypedDecision(key *SigningKey, domain *Eip712Domain, d *AmlDecision) (*TypedDecision, error) {
+	if key.typ != KeySecp256k1 {
+		return nil, fmt.Errorf("EIP-712 decisions must be signed by a secp256k1 key, not %s", key.typ)
+	}
+	digest := d.Digest(domain)
+	sig := ecdsa.SignCompact(key.k1, digest[:], false)
+	return &TypedDecision{
+		Types:       eip712Types,
+		PrimaryType: "AmlDecision",
+		Domain:      domain,
+		Message:     d,
+		Encoded:     d.Encode(),
+		Digest:      digest,
+		Signature:   append(sig[1:], sig[0]),
+		Signer:      ethAddress(key.k1.PubKey()),
+	}, nil
+}
+
+// VerifyTypedDecision checks a signed decision and returns the decision that
+// was encoded. The message must match the encoding, the digest must be that
+// of the encoding in the domain, and the signature must be a canonical (low S)
+// signature of the digest by the signer. If any addresses are given, the
+// signer must be one of them.
+func VerifyTypedDecision(td *TypedDecision, trusted ...common.Address) (*AmlDecision, error) {
+	if td.Domain == nil {
+		return nil, errors.New("missing domain")
+	}
+	d, err := DecodeAmlDecision(td.Encoded)
+	if err != nil {
+		return nil, err
+	}
+	if td.Message != nil && !bytes.Equal(td.Message.Encode(), td.Encoded) {
+		return nil, errors.New("the message does not match the encoded decision")
+	}
+	digest := d.Digest(td.Domain)
+	if digest != td.Digest {
+		return nil, fmt.Errorf("digest mismatch: want %x, got %x", digest, td.Digest)
+	}
+
+	sig := td.Signature
+	if len(sig) != 65 {
+		return nil, fmt.Errorf("invalid signature: want 65 bytes, got %d", len(sig))
+	}
+	var s secp256k1.ModNScalar
+	if s.SetByteSlice(sig[32:64]) || s.IsOverHalfOrder() {
+		return nil, errors.New("invalid signature: S is not canonical")
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return nil, fmt.Errorf("invalid signature: V is %d", sig[64])
+	}
+	pub, _, err := ecdsa.RecoverCompact(append([]byte{27 + v}, sig[:64]...), digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	signer := ethAddress(pub)
+	if signer != td.Signer {
+		return nil, fmt.Errorf("decision was signed by %v, not %v", signer, td.Signer)
+	}
+	if len(trusted) > 0 && !containsAddress(trusted, signer) {
+		return nil, fmt.Errorf("decision was signed by %v, which is not trusted", signer)
+	}
+	return d, nil
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// ethAddress returns the Ethereum address of a public key.
+func ethAddress(pub *secp256k1.PublicKey) common.Address {
+	return common.BytesToAddress(keccak(pub.SerializeUncompressed()[1:]).Bytes()[12:])
+}
+
+func keccak(data ...[]byte) common.Hash {
+	h := sha3.NewLegacyKeccak256()
+	for _, b := range data {
+		h.Write(b)
+	}
+	return common.Hash(h.Sum(nil))
+}
+
+func uintWord(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(make([]byte, 24), v)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetEip712Domain sets the domain results are signed in as EIP-712 decisions,
+// in addition to their attestation. The signing key must be a secp256k1 key.
+// If it is never set, no EIP-712 decision is produced.
+func (e *Engine) SetEip712Domain(d *Eip712Domain) { e.eip712.Store(d) }
+
+// Eip712Domain returns the EIP-712 domain, or nil.
+func (e *Engine) Eip712Domain() *Eip712Domain { return e.eip712.Load() }
@@ -0,0 +1,181 @@
+package rules_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+func TestEip712DomainSeparator(t *testing.T) {
+	// The example of EIP-712
+	d := &rules.Eip712Domain{
+		Name:              "Ether Mail",
+		Version:           "1",
+		ChainID:           1,
+		VerifyingContract: common.HexToAddress("0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"),
+	}
+	if got := d.Separator().Hex(); got != "0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+// TestEip712Vectors checks the test vectors in testdata/eip712, which can be
+// used to test contracts that check decisions. Each vector lists times the
+// decision is and is not fresh at.
+func TestEip712Vectors(t *testing.T) {
+	var vectors []struct {
+		Name      string               `json:"name"`
+		Key       string               `json:"key"`
+		Statement *rules.Statement     `json:"statement"`
+		Decision  *rules.TypedDecision `json:"decision"`
+		Freshness []struct {
+			Time  time.Time `json:"time"`
+			Fresh bool      `json:"fresh"`
+		} `json:"freshness"`
+	}
+	err := json.Unmarshal(must1(os.ReadFile("testdata/eip712/vectors.json")), &vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			d := must1(rules.NewAmlDecision(v.Statement))
+			td := must1(rules.SignTypedDecision(must1(rules.ParseSigningKey(v.Key)), v.Decision.Domain, d))
+			if got, want := must1(json.Marshal(td)), must1(json.Marshal(v.Decision)); !bytes.Equal(got, want) {
+				t.Fatalf("want\n%s\ngot\n%s", want, got)
+			}
+			d, err := rules.VerifyTypedDecision(v.Decision, v.Decision.Signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range v.Freshness {
+				if err := d.CheckTime(f.Time); (err == nil) != f.Fresh {
+					t.Fatalf("want fresh %v at %v, got %v", f.Fresh, f.Time, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTypedDecision(t *testing.T) {
+	// The address of the private key 1 is well known
+	key := must1(rules.ParseSigningKey("secp256k1:" + strings.Repeat("00", 31) + "01"))
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	engine.SetClock(rules.FixedClock(now))
+	engine.SetSigningKey(key)
+	engine.SetEip712Domain(rules.CitreaTestnet)
+
+	cert := []*rules.IdentityCertificate{{Target: "primaryAml", ID: [32]byte{1}, Data: map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	}}}
+	userOp := "0x" + strings.Repeat("44", 32)
+	screenTo := func(recipient, amount string) (*rules.Result, error) {
+		tx := &rules.Transaction{
+			Sender:    url.MustParse("alice.acme"),
+			Recipient: recipient,
+			Token:     "0xE77C4167B2020B73AD10f82aE086BF0D844CF200",
+			Amount:    json.Number(amount),
+		}
+		var recipientCert []*rules.IdentityCertificate
+		if !common.IsHexAddress(recipient) {
+			recipientCert = cert
+		}
+		return engine.EvaluateTransaction(context.Background(), &rules.Request{Transaction: tx, UserOpHash: userOp}, cert, recipientCert)
+	}
+	screen := func(amount string) (*rules.Result, error) {
+		return screenTo("0x2dF4FEbedcDabfB6E909Df7A422C57dC3a3966bB", amount)
+	}
+
+	res, err := screen("2500000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := common.HexToAddress("0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf")
+	d, err := rules.VerifyTypedDecision(res.Eip712, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Denied || d.Recipient != common.HexToAddress("0x2dF4FEbedcDabfB6E909Df7A422C57dC3a3966bB") || d.RecipientIdentity != (common.Hash{}) ||
+		(*big.Int)(d.Amount).String() != "2500000" || d.IssuedAt != uint64(now.Unix()) || !d.Live || d.Aggregation != 0 ||
+		d.UserOpHash != common.HexToHash(userOp) || d.Nonce == (common.Hash{}) {
+		t.Fatalf("got %+v", d)
+	}
+
+	// The decision expires after its lifetime, and each decision has its own
+	// nonce
+	if d.ExpiresAt != uint64(now.Add(rules.DefaultDecisionLifetime).Unix()) {
+		t.Fatalf("want the decision to expire after %v, got %d", rules.DefaultDecisionLifetime, d.ExpiresAt)
+	}
+	if err := d.CheckTime(now.Add(rules.DefaultDecisionLifetime + time.Second)); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("want an expired decision, got %v", err)
+	}
+	if res := must1(screen("2500000")); res.Eip712.Message.Nonce == d.Nonce {
+		t.Fatal("want a new nonce for each decision")
+	}
+
+	// An ADI recipient is bound by the hash of its URL
+	res2 := must1(screenTo("bob.acme", "2500000"))
+	if m := res2.Eip712.Message; m.Recipient != (common.Address{}) || m.RecipientIdentity != crypto.Keccak256Hash([]byte("acc://bob.acme")) {
+		t.Fatalf("want the ADI's hash, got %+v", m)
+	}
+
+	tamper := func(fn func(td *rules.TypedDecision), want string) {
+		t.Helper()
+		b := must1(json.Marshal(res.Eip712))
+		td := new(rules.TypedDecision)
+		must1(td, json.Unmarshal(b, td))
+		fn(td)
+		_, err := rules.VerifyTypedDecision(td, signer)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("want %q, got %v", want, err)
+		}
+	}
+	tamper(func(td *rules.TypedDecision) { td.Encoded[5*32+31] ^= 1 }, "does not match")
+	tamper(func(td *rules.TypedDecision) { td.Message = nil; td.Encoded[5*32+31] ^= 1 }, "digest mismatch")
+	tamper(func(td *rules.TypedDecision) { td.Message = nil; td.Encoded[16*32+31] = 2 }, "live is not a boolean")
+	tamper(func(td *rules.TypedDecision) { td.Domain = &rules.Eip712Domain{ChainID: 1} }, "digest mismatch")
+	tamper(func(td *rules.TypedDecision) { td.Signature[64] = 27 + 28 - td.Signature[64] }, "signed by")
+	tamper(func(td *rules.TypedDecision) { td.Signer = common.Address{1} }, "signed by")
+	tamper(func(td *rules.TypedDecision) { td.Signature[32] = 0xff }, "not canonical")
+
+	_, err = rules.VerifyTypedDecision(res.Eip712, common.Address{1})
+	if err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Fatalf("want an untrusted signer, got %v", err)
+	}
+
+	// The user operation hash must be 32 bytes
+	userOp = "0x44"
+	_, err = screen("2500000")
+	if err == nil || !strings.Contains(err.Error(), "user operation hash") {
+		t.Fatalf("want an invalid user operation hash, got %v", err)
+	}
+	userOp = ""
+
+	// Amounts are in the token's base units
+	_, err = screen("2.5")
+	if err == nil || !strings.Contains(err.Error(), "base units") {
+		t.Fatalf("want an invalid amount, got %v", err)
+	}
+
+	// EIP-712 decisions need a secp256k1 key
+	engine.SetSigningKey(must1(rules.ParseSigningKey("ed25519:" + strings.Repeat("01", 32))))
+	_, err = screen("2500000")
+	if err == nil || !strings.Contains(err.Error(), "secp256k1") {
+		t.Fatalf("want a key type error, got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/addresses"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+)
+
+// Engine executes requests against a registry of rulesets that can be
+// replaced while the engine is running. Each execution uses the ruleset that
+// was active when it started.
+type Engine struct {
+	registry atomic.Pointer[Registry]
+	coverage atomic.Pointer[Coverage]
+	catalog  atomic.Pointer[Catalog]
+	clock    atomic.Pointer[Clock]
+
+	sanctions atomic.Pointer[sanctions.List]
+	addresses atomic.Pointer[addresses.Book]
+	anchors   atomic.Pointer[[]*Anchor]
+
+	signingKey atomic.Pointer[SigningKey]
+	eip712     atomic.Pointer[Eip712Domain]
+	lifetime   atomic.Pointer[time.Duration]
+}
+
+var defaultEngine = NewEngine(defaultRegistry)
+
+func NewEngine(registry Registry) *Engine {
+	e := new(Engine)
+	e.SetRegistry(registry)
+	return e
+}
+
+// Registry returns the active registry.
+func (e *Engine) Registry() Registry { return *e.registry.Load() }
+
+// SetRegistry atomically replaces the active registry.
+func (e *Engine) SetRegistry(registry Registry) { e.registry.Store(&registry) }
+
+// Ruleset returns the named ruleset from the active registry, or the default
+// ruleset if the name is empty.
+func (e *Engine) Ruleset(name string) (*Ruleset, error) { return e.Registry().Get(name) }
+
+func (e *Engine) Execute(ctx context.Context, client api.Querier, req *Request) (*Result, error) {
+	if req.Identity == nil && req.Transaction == nil {
+		return nil, fmt.Errorf("missing metadata URL")
+	}
+	if req.Identity != nil && req.Transaction != nil {
+		return nil, fmt.Errorf("a request has an identity or a transaction, not both")
+	}
+
+	// Capture the ruleset before doing anything else so a reload cannot change
+	// it mid-request
+	rs, err := e.Ruleset(req.Ruleset)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, proved := withProofs(ctx, e.Anchors())
+	res, err := e.execute(ctx, client, rs, req)
+	if err != nil {
+		return nil, err
+	}
+	res.Proofs = proved.list()
+	return e.attest(rs, req, res)
+}
+
+// execute fetches the on-chain state of the request and evaluates it.
+func (e *Engine) execute(ctx context.Context, client api.Querier, rs *Ruleset, req *Request) (*Result, error) {
+	// A replay proves the version of the ruleset it replays instead
+	if rs.txn != nil && req.Replay == nil {
+		err := proveEntry(ctx, client, rs.Account, rs.txn)
+		if err != nil {
+			return nil, fmt.Errorf("prove ruleset: %w", err)
+		}
+	}
+
+	if req.Transaction != nil {
+		if req.Replay != nil {
+			return nil, fmt.Errorf("transactions cannot be replayed")
+		}
+		return e.screen(ctx, client, rs, req)
+	}
+	if req.Replay != nil {
+		return e.replay(ctx, client, rs, req)
+	}
+
+	certs, err := FetchAmlCerts(ctx, client, req.Identity)
+	if err != nil {
+		return nil, err
+	}
+	err = fetchIssuers(ctx, client, rs, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	req = e.withTime(req)
+	history, err := e.history(ctx, client, rs, req, req.Identity)
+	if err != nil {
+		return nil, err
+	}
+	return e.evaluateCertificates(ctx, rs, req, certs, history...)
+}
+
+// Evaluate executes the request's ruleset against a certificate that has
+// already been fetched. If the ruleset only trusts certain issuers, the
+// certificate is denied since its signers are unknown; use
+// [Engine.EvaluateCertificates] instead.
+func (e *Engine) Evaluate(ctx context.Context, req *Request, cert vm.Entity) (*Result, error) {
+	rs, err := e.Ruleset(req.Ruleset)
+	if err != nil {
+		return nil, err
+	}
+	timed := e.withTime(req)
+	if len(rs.TrustedIssuers) > 0 {
+		return e.attest(rs, req, e.untrustedResult(rs, timed))
+	}
+	history, err := e.history(ctx, nil, rs, timed, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.evaluate(ctx, rs, timed, cert, history...)
+	if err != nil {
+		return nil, err
+	}
+	return e.attest(rs, req, res)
+}
+
+// evaluate executes the ruleset against a certificate. The entities, such as
+// the identity the certificate belongs to, are made available to the tables.
+func (e *Engine) evaluate(ctx context.Context, rs *Ruleset, req *Request, cert vm.Entity, entities ...vm.Entity) (*Result, error) {
+	asOf := e.Clock().Now()
+	if req.AsOf != nil {
+		asOf = *req.AsOf
+	}
+	ctx = withEvaluationTime(ctx, asOf)
+	for _, entity := range entities {
+		if h, ok := entity.(*historyEntity); ok {
+			ctx = withHistory(ctx, h.history)
+		}
+	}
+	ctx, screened := withScreening(ctx, e.Sanctions())
+
+	// Build raw certificates from the EDD so malformed certificates are
+	// denied instead of failing or silently passing
+	if j, ok := cert.(*jEntity); ok && j.name == "certificate" {
+		var violations []*SchemaViolation
+		cert, violations = ValidateCertificate(rs, j.values)
+		if len(violations) > 0 {
+			res := violationResult(rs, violations)
+			res.AsOf = asOf
+			res.Locale = e.Catalog().Negotiate(req.Locale)
+			for _, v := range violations {
+				res.Reasons = append(res.Reasons, e.render(res.Locale, v.reason(), v.Message))
+			}
+			return res, nil
+		}
+	}
+
+	var rec *spanRecorder
+	cov := e.coverage.Load()
+	if req.Explain || cov != nil {
+		rec = newSpanRecorder()
+		ctx = vm.WithTraceProvider(ctx, rec)
+	}
+
+	s := vm.New()
+	s.SetContext(ctx)
+	result := newEntity(rs.Entities, "result")
+	must(s.Entity().Push(hostOperators, rs.Tables))
+	must(s.Entity().Push(entities...))
+	must(s.Entity().Push(result, cert))
+
+	err := vm.ExecuteString(s, rs.Entry)
+	if cov != nil {
+		// Record the coverage even if execution failed
+		cov.add(rs, rec.Explain(rs))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{
+		Denied:       getFieldAs(s, result, "denied", vm.AsBool),
+		DenialReason: getFieldAs(s, result, "denialReason", vm.AsAny),
+		Ruleset:      rs.ref(),
+		AsOf:         asOf,
+
+		SanctionsHits: screened.hits,
+	}
+
+	if score := getFieldAs(s, result, "riskScore", vm.AsAny); score != nil {
+		res.RiskScore, err = vm.AsFloat(must1(vm.AsValue(score)))
+		if err != nil {
+			return nil, fmt.Errorf("riskScore: %w", err)
+		}
+	}
+	if tier := getFieldAs(s, result, "riskTier", vm.AsAny); tier != nil {
+		res.RiskTier = RiskTier(fmt.Sprint(tier))
+	}
+	if actions := getFieldAs(s, result, "recommendedActions", vm.AsAny); actions != nil {
+		res.RecommendedActions = denialReasons(actions)
+	}
+
+	res.Locale = e.Catalog().Negotiate(req.Locale)
+	res.Reasons = e.reasons(s, res.Locale, cert, res.DenialReason)
+	if review := getFieldAs(s, result, "reviewReason", vm.AsAny); review != nil {
+		res.ReviewReasons = e.reasons(s, res.Locale, cert, review)
+	}
+
+	err = rs.RiskThresholds.grade(res)
+	if err != nil {
+		return nil, err
+	}
+
+	// A certificate the tables prohibited without saying why is still given
+	// a reason
+	if res.Denied && len(res.Reasons) == 0 {
+		const code = "RISK_PROHIBITED"
+		rc, _ := reasonCodes.lookup(code)
+		res.DenialReason = []any{rc.Text}
+		res.Reasons = []*Reason{e.render(res.Locale, &Reason{Code: code}, rc.Text)}
+	}
+
+	if req.Explain {
+		res.Explain = rec.Explain(rs)
+	}
+	return res, nil
+}
+
+// Watch polls the directory and, once its contents have changed and then been
+// stable for an interval, compiles it and swaps in the new registry. Waiting
+// for the directory to settle avoids compiling an EDD and a DT that are only
+// partly written. If scanning or compilation fails the error is logged and the
+// active registry is kept. The client is used to fetch rulesets pinned to a
+// data account. Watch returns once the context is canceled.
+//
+// Loaded is the [Fingerprint] of the directory taken before the active
+// registry was loaded from it, so a change made while it was loading is
+// picked up.
+func (e *Engine) Watch(ctx context.Context, client api.Querier, dir, loaded string, interval time.Duration) {
+	pending := loaded
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		fp, err := Fingerprint(dir)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to scan rules directory", "dir", dir, "error", err)
+			continue
+		}
+		if fp != pending {
+			// Wait for the directory to stop changing
+			pending = fp
+			continue
+		}
+		if fp == loaded {
+			continue
+		}
+		loaded = fp
+
+		r, err := LoadRegistryDir(ctx, client, dir)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to reload rules", "dir", dir, "error", err)
+			continue
+		}
+		e.SetRegistry(r)
+		slog.InfoContext(ctx, "Reloaded rules", "dir", dir, "rulesets", r.Names())
+	}
+}
+
+// Fingerprint summarizes the name, size, and modification time of every file
+// in the directory tree.
+func Fingerprint(dir string) (string, error) {
+	var s string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s += fmt.Sprintf("%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return s, err
+}
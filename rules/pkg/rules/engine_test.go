@@ -0,0 +1,189 @@
+package rules_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestExplain(t *testing.T) {
+	cert := rules.NewCertificate(map[string]any{
+		"certificationStatus": "failed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2025-01-01",
+	})
+
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	res, err := engine.Evaluate(context.Background(), &rules.Request{Explain: true}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied {
+		t.Fatal("expected the certificate to be denied")
+	}
+	if res.Explain == nil || len(res.Explain.Tables) != 1 {
+		t.Fatalf("expected one table in the explanation, got %+v", res.Explain)
+	}
+
+	table := res.Explain.Tables[0]
+	if table.Name != "Validate_Certificate" {
+		t.Fatalf("want table Validate_Certificate, got %s", table.Name)
+	}
+
+	// Case 1 checks condition 1, which is false; case 2 checks condition 2,
+	// which is true and fires
+	var results []any
+	for _, c := range table.Conditions {
+		results = append(results, c.Result)
+	}
+	if len(results) != 2 || results[0] != false || results[1] != true {
+		t.Fatalf("want conditions [false true], got %v", results)
+	}
+	if len(table.Cases) != 1 || table.Cases[0].Number != 2 {
+		t.Fatalf("want case 2 to fire, got %+v", table.Cases)
+	}
+	if len(table.Cases[0].Actions) != 1 || table.Cases[0].Actions[0].Number != 2 {
+		t.Fatalf("want action 2 to run, got %+v", table.Cases[0].Actions)
+	}
+
+	// Without explain, no trace is returned
+	res, err = engine.Evaluate(context.Background(), &rules.Request{}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Explain != nil {
+		t.Fatal("expected no explanation")
+	}
+}
+
+func TestTableType(t *testing.T) {
+	// The columns are referred to out of order, so the legacy compiler would
+	// order the cases 2, 1
+	engine := func(typ string) *rules.Engine {
+		t.Helper()
+		dt := fmt.Sprintf(`<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<attribute_fields><TYPE>%s</TYPE></attribute_fields>
+<conditions>
+<condition_details><condition_number>1</condition_number><condition_postfix>certificationStatus "failed" sic==</condition_postfix><condition_column column_number="2" column_value="Y"></condition_column></condition_details>
+<condition_details><condition_number>2</condition_number><condition_postfix>dataOperationType "delete" sic==</condition_postfix><condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions>
+<action_details><action_number>1</action_number><action_postfix>true cvb /denied xdef "revoked" denialReason swap addto</action_postfix><action_column column_number="1" column_value="X"></action_column></action_details>
+<action_details><action_number>2</action_number><action_postfix>true cvb /denied xdef "failed" denialReason swap addto</action_postfix><action_column column_number="2" column_value="X"></action_column></action_details>
+</actions>
+</decision_table></decision_tables>`, typ)
+
+		return rules.NewEngine(must1(rules.NewRegistry(testRuleset(t, dt))))
+	}
+
+	cert := rules.NewCertificate(map[string]any{
+		"certificationStatus": "failed",
+		"dataOperationType":   "delete",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2099-01-01",
+	})
+	for typ, want := range map[string]string{
+		"FIRST": "[revoked]",
+		"ALL":   "[revoked failed]",
+	} {
+		t.Run(typ, func(t *testing.T) {
+			res, err := engine(typ).Evaluate(context.Background(), &rules.Request{}, cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(res.DenialReason); got != want {
+				t.Fatalf("want %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestCaseNumbers(t *testing.T) {
+	// The cases are in columns 4 and 2, referred to in that order
+	rs := testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<attribute_fields><TYPE>ALL</TYPE></attribute_fields>
+<conditions>
+<condition_details><condition_number>1</condition_number><condition_postfix>certificationStatus "failed" sic==</condition_postfix><condition_column column_number="4" column_value="Y"></condition_column></condition_details>
+<condition_details><condition_number>2</condition_number><condition_postfix>dataOperationType "delete" sic==</condition_postfix><condition_column column_number="2" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions>
+<action_details><action_number>1</action_number><action_postfix>true cvb /denied xdef "revoked" denialReason swap addto</action_postfix><action_column column_number="2" column_value="X"></action_column></action_details>
+<action_details><action_number>2</action_number><action_postfix>true cvb /denied xdef "failed" denialReason swap addto</action_postfix><action_column column_number="4" column_value="X"></action_column></action_details>
+</actions>
+</decision_table></decision_tables>`)
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+	coverage := rules.NewCoverage()
+	engine.CollectCoverage(coverage)
+
+	// Explanations and coverage number the cases by their column
+	res, err := engine.Evaluate(context.Background(), &rules.Request{Explain: true}, rules.NewCertificate(map[string]any{
+		"certificationStatus": "failed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2099-01-01",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cases := res.Explain.Tables[0].Cases; len(cases) != 1 || cases[0].Number != 4 {
+		t.Fatalf("want case 4 to fire, got %+v", cases)
+	}
+	cases := coverage.Report().Tables[0].Cases
+	if len(cases) != 2 || cases[0].Number != 2 || cases[0].Fired != 0 || cases[1].Number != 4 || cases[1].Fired != 1 {
+		t.Fatalf("want cases 2 and 4 with 4 fired, got %+v %+v", cases[0], cases[1])
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	// Modifying the default registry does not modify the built-in rules
+	r := rules.DefaultRegistry()
+	delete(r, rules.DefaultRulesetName)
+	if _, ok := rules.DefaultRegistry()[rules.DefaultRulesetName]; !ok {
+		t.Fatal("want a copy of the default registry")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	edd := must1(os.ReadFile("compiled_edd.xml"))
+	dt := must1(os.ReadFile("compiled_dt.xml"))
+	must1(0, os.WriteFile(filepath.Join(dir, "compiled_edd.xml"), edd, 0644))
+	must1(0, os.WriteFile(filepath.Join(dir, "compiled_dt.xml"), dt, 0644))
+
+	// A change made after the directory is fingerprinted, while the rules
+	// are loading, is applied once the directory is stable
+	loaded := must1(rules.Fingerprint(dir))
+	engine := rules.NewEngine(must1(rules.LoadRegistryDir(context.Background(), nil, dir)))
+	dt = bytes.Replace(dt, []byte("Certification failed"), []byte("Certification was failed"), 1)
+	must1(0, os.WriteFile(filepath.Join(dir, "compiled_dt.xml"), dt, 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { engine.Watch(ctx, nil, dir, loaded, 10*time.Millisecond); close(done) }()
+	defer func() { cancel(); <-done }()
+
+	want := rules.DefaultRuleset().Hash
+	for start := time.Now(); engine.Registry()[rules.DefaultRulesetName].Hash == want; {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the rules were not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Removing the directory keeps the active rules
+	want = engine.Registry()[rules.DefaultRulesetName].Hash
+	must1(0, os.RemoveAll(dir))
+	time.Sleep(50 * time.Millisecond)
+	if engine.Registry()[rules.DefaultRulesetName].Hash != want {
+		t.Fatal("the rules changed")
+	}
+}
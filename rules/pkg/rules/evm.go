@@ -0,0 +1,76 @@
+package rules
+
+import (
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/addresses"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
+)
+
+// EvmAddress is the screening of a transaction's EVM recipient.
+type EvmAddress struct {
+	*addresses.Info
+
+	// Checksummed is set if the address has an EIP-55 checksum, and
+	// ChecksumValid unless the checksum is wrong.
+	Checksummed   bool `json:"checksummed"`
+	ChecksumValid bool `json:"checksumValid"`
+
+	// Sanctions are the sanctions list entries with the address.
+	Sanctioned bool               `json:"sanctioned"`
+	Sanctions  []*sanctions.Entry `json:"sanctions,omitempty"`
+}
+
+// evmAddressFields are the fields of the evmAddress entity, which is available
+// to the decision tables while screening a transaction. If the recipient is
+// an ADI they are empty or false, except checksumValid.
+var evmAddressFields = []string{"address", "checksummed", "checksumValid", "denylisted", "sanctioned", "addressLabels", "addressRisk", "accountType"}
+
+// screenAddress screens an EVM address against the address book and the
+// addresses of the sanctions list.
+func (e *Engine) screenAddress(addr string) (*EvmAddress, error) {
+	book := e.AddressBook()
+	if book == nil {
+		book = addresses.NewBook()
+	}
+	info, err := book.Lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	a := &EvmAddress{
+		Info:          info,
+		Checksummed:   addresses.HasChecksum(addr),
+		ChecksumValid: addresses.ValidChecksum(addr),
+	}
+	if list := e.Sanctions(); list != nil {
+		a.Sanctions = list.SearchAddress(addr)
+		a.Sanctioned = len(a.Sanctions) > 0
+	}
+	return a, nil
+}
+
+func (a *EvmAddress) entity() *jEntity {
+	if a == nil {
+		a = &EvmAddress{Info: new(addresses.Info), ChecksumValid: true}
+	}
+	labels := []any{}
+	for _, l := range a.Labels {
+		labels = append(labels, l.Name)
+	}
+	return &jEntity{"evmAddress", map[string]any{
+		"address":       a.Address,
+		"checksummed":   a.Checksummed,
+		"checksumValid": a.ChecksumValid,
+		"denylisted":    a.Denylisted,
+		"sanctioned":    a.Sanctioned,
+		"addressLabels": labels,
+		"addressRisk":   a.Risk,
+		"accountType":   a.AccountType,
+	}}
+}
+
+// SetAddressBook replaces the denylists, risk labels, and code map EVM
+// recipients are screened against. If it is never set, no address is labelled
+// and the type of every account is unknown.
+func (e *Engine) SetAddressBook(b *addresses.Book) { e.addresses.Store(b) }
+
+// AddressBook returns the address book, or nil.
+func (e *Engine) AddressBook() *addresses.Book { return e.addresses.Load() }
@@ -0,0 +1,133 @@
+package rules_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/addresses"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+func TestEvmAddressScreening(t *testing.T) {
+	// Deny invalid checksums and denylisted and sanctioned addresses, and
+	// review medium risk contracts
+	rs := testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<attribute_fields><TYPE>ALL</TYPE></attribute_fields>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>checksumValid not</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+<condition_details>
+<condition_number>2</condition_number>
+<condition_postfix>denylisted</condition_postfix>
+<condition_column column_number="2" column_value="Y"></condition_column></condition_details>
+<condition_details>
+<condition_number>3</condition_number>
+<condition_postfix>sanctioned</condition_postfix>
+<condition_column column_number="3" column_value="Y"></condition_column></condition_details>
+<condition_details>
+<condition_number>4</condition_number>
+<condition_postfix>accountType "contract" s== addressRisk "medium" s== &amp;&amp;</condition_postfix>
+<condition_column column_number="4" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions>
+<action_details>
+<action_number>1</action_number>
+<action_postfix>true /denied xdef "EVM_CHECKSUM_INVALID" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details>
+<action_details>
+<action_number>2</action_number>
+<action_postfix>true /denied xdef "EVM_ADDRESS_DENYLISTED" denialReason swap addto</action_postfix>
+<action_column column_number="2" column_value="X"></action_column></action_details>
+<action_details>
+<action_number>3</action_number>
+<action_postfix>true /denied xdef "EVM_ADDRESS_SANCTIONED" denialReason swap addto</action_postfix>
+<action_column column_number="3" column_value="X"></action_column></action_details>
+<action_details>
+<action_number>4</action_number>
+<action_postfix>"Contract with a medium risk" reviewReason swap addto</action_postfix>
+<action_column column_number="4" column_value="X"></action_column></action_details>
+</actions>
+</decision_table></decision_tables>`)
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+
+	book := addresses.NewBook()
+	for _, err := range []error{
+		book.Add(&addresses.Label{Name: "mixer", Risk: addresses.RiskHigh, Deny: true}, "0x722122df12d4e14e13ac3b6895a86e84145b6967"),
+		book.Add(&addresses.Label{Name: "gambling", Risk: addresses.RiskMedium}, "0x00000000219ab540356cBB839Cbe05303d7705Fa"),
+		book.SetCode("0x00000000219ab540356cBB839Cbe05303d7705Fa", []byte{0x60, 0x80}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine.SetAddressBook(book)
+	engine.SetSanctions(sanctions.NewList([]*sanctions.Entry{
+		{ID: "1001", Name: "Vladimir IVANOV", Addresses: []string{"0x8589427373D6D84E98730D7795D8f6f8731FDA16"}},
+	}))
+
+	cert := []*rules.IdentityCertificate{{Target: "primaryAml", Data: map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	}}}
+	asOf := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	screen := func(recipient string) *rules.Result {
+		t.Helper()
+		tx := &rules.Transaction{Sender: url.MustParse("alice.acme"), Recipient: recipient, Amount: "100"}
+		var recipientCert []*rules.IdentityCertificate
+		if !strings.HasPrefix(recipient, "0x") {
+			recipientCert = cert
+		}
+		res, err := engine.EvaluateTransaction(context.Background(), &rules.Request{Transaction: tx, AsOf: &asOf}, cert, recipientCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	codes := func(res *rules.Result) []string {
+		var codes []string
+		for _, r := range res.Reasons {
+			codes = append(codes, r.Code)
+		}
+		return codes
+	}
+
+	cases := []struct {
+		name, recipient string
+		reasons         []string
+	}{
+		{"clean", "0x742d35Cc6634C0532925a3b844Bc454e4438f44e", nil},
+		{"bad checksum", "0x742d35Cc6634C0532925a3b844Bc454e4438F44e", []string{"EVM_CHECKSUM_INVALID"}},
+		{"denylisted", "0x722122DF12D4E14E13AC3B6895A86E84145B6967", []string{"EVM_ADDRESS_DENYLISTED"}},
+		{"sanctioned", "0x8589427373d6d84e98730d7795d8f6f8731fda16", []string{"EVM_ADDRESS_SANCTIONED"}},
+		{"ADI", "bob.acme", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := screen(c.recipient)
+			if !slices.Equal(codes(res), c.reasons) {
+				t.Fatalf("want %v, got %v", c.reasons, codes(res))
+			}
+			if (res.EvmAddress == nil) != (c.recipient == "bob.acme") {
+				t.Fatalf("want the screening of EVM recipients only, got %+v", res.EvmAddress)
+			}
+		})
+	}
+
+	res := screen("0x00000000219ab540356cbb839cbe05303d7705fa")
+	if res.Denied || len(res.ReviewReasons) != 1 || res.EvmAddress.AccountType != addresses.AccountContract {
+		t.Fatalf("want a review of a medium risk contract, got %+v", res)
+	}
+	if res := screen("0x8589427373d6d84e98730d7795d8f6f8731fda16"); len(res.EvmAddress.Sanctions) != 1 || res.EvmAddress.Sanctions[0].ID != "1001" {
+		t.Fatalf("want the sanctions entry of the address, got %+v", res.EvmAddress)
+	}
+}
@@ -0,0 +1,185 @@
+package rules
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// Explanation is a trace of the decision tables executed for a request.
+type Explanation struct {
+	Tables []*TableTrace `json:"tables"`
+}
+
+// TableTrace records the execution of a decision table.
+type TableTrace struct {
+	Name       string            `json:"name"`
+	Conditions []*ConditionTrace `json:"conditions"`
+	Cases      []*CaseTrace      `json:"cases"`
+}
+
+// ConditionTrace records the evaluation of a condition. Result is true, false,
+// or nil if the condition evaluated to null.
+type ConditionTrace struct {
+	Number  int    `json:"number"`
+	Postfix string `json:"postfix"`
+	Result  any    `json:"result"`
+}
+
+// CaseTrace records a case (column) that fired and the actions it ran.
+type CaseTrace struct {
+	Number  int            `json:"number"`
+	Actions []*ActionTrace `json:"actions"`
+}
+
+// ActionTrace records the execution of an action, including any tables it
+// executed.
+type ActionTrace struct {
+	Number  int           `json:"number"`
+	Postfix string        `json:"postfix"`
+	Tables  []*TableTrace `json:"tables,omitempty"`
+}
+
+// Explain builds an explanation from the spans recorded by the decision table
+// engine. Condition, case, and action numbers are one-based to match the
+// numbering of the decision table source, and case numbers are the case's
+// column in the ruleset's source.
+func (r *spanRecorder) Explain(rs *Ruleset) *Explanation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Explanation{Tables: explainTables(rs, r.roots)}
+}
+
+func explainTables(rs *Ruleset, spans []*recordedSpan) []*TableTrace {
+	var tables []*TableTrace
+	for _, s := range spans {
+		if s.name != "ExecuteNamed" {
+			tables = append(tables, explainTables(rs, s.children)...)
+			continue
+		}
+
+		// A named value that is not a table
+		exec := s.child("ExecuteTable")
+		if exec == nil {
+			tables = append(tables, explainTables(rs, s.children)...)
+			continue
+		}
+
+		table := &TableTrace{Name: s.attrs["Name"].AsString()}
+		tables = append(tables, table)
+		for _, c := range exec.children {
+			switch c.name {
+			case "ExecuteCondition":
+				cond := &ConditionTrace{
+					Number:  int(c.attrs["Number"].AsInt64()) + 1,
+					Postfix: c.attrs["Postscript"].AsString(),
+				}
+				if v, ok := c.attrs["Result"]; ok && v.Type() == attribute.BOOL {
+					cond.Result = v.AsBool()
+				}
+				table.Conditions = append(table.Conditions, cond)
+
+			case "ExecuteCase":
+				kase := &CaseTrace{Number: rs.caseNumber(table.Name, int(c.attrs["Number"].AsInt64()))}
+				table.Cases = append(table.Cases, kase)
+				for _, a := range c.children {
+					if a.name != "ExecuteAction" {
+						continue
+					}
+					kase.Actions = append(kase.Actions, &ActionTrace{
+						Number:  int(a.attrs["Number"].AsInt64()) + 1,
+						Postfix: a.attrs["Postscript"].AsString(),
+						Tables:  explainTables(rs, a.children),
+					})
+				}
+			}
+		}
+	}
+	return tables
+}
+
+// spanRecorder is a minimal in-process tracer provider that keeps every span
+// started through it, in order, so the execution can be inspected afterwards.
+type spanRecorder struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	roots []*recordedSpan
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+	*spanRecorder
+}
+
+var _ trace.TracerProvider = (*spanRecorder)(nil)
+var _ trace.Tracer = recordingTracer{}
+
+func newSpanRecorder() *spanRecorder { return new(spanRecorder) }
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{spanRecorder: r}
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	r := t.spanRecorder
+	s := &recordedSpan{recorder: r, name: name, attrs: map[attribute.Key]attribute.Value{}}
+	cfg := trace.NewSpanStartConfig(opts...)
+	s.SetAttributes(cfg.Attributes()...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if parent, ok := trace.SpanFromContext(ctx).(*recordedSpan); ok && parent.recorder == r {
+		parent.children = append(parent.children, s)
+	} else {
+		r.roots = append(r.roots, s)
+	}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type recordedSpan struct {
+	embedded.Span
+
+	recorder *spanRecorder
+	name     string
+	attrs    map[attribute.Key]attribute.Value
+	children []*recordedSpan
+}
+
+var _ trace.Span = (*recordedSpan)(nil)
+
+func (s *recordedSpan) child(name string) *recordedSpan {
+	for _, c := range s.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	for _, kv := range kv {
+		s.attrs[kv.Key] = kv.Value
+	}
+}
+
+func (s *recordedSpan) SetName(name string) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.name = name
+}
+
+func (s *recordedSpan) End(...trace.SpanEndOption)              {}
+func (s *recordedSpan) AddEvent(string, ...trace.EventOption)   {}
+func (s *recordedSpan) AddLink(trace.Link)                      {}
+func (s *recordedSpan) IsRecording() bool                       { return true }
+func (s *recordedSpan) RecordError(error, ...trace.EventOption) {}
+func (s *recordedSpan) SpanContext() trace.SpanContext          { return trace.SpanContext{} }
+func (s *recordedSpan) SetStatus(codes.Code, string)            {}
+func (s *recordedSpan) TracerProvider() trace.TracerProvider    { return s.recorder }
@@ -1,38 +1,53 @@
 package rules
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/C3Rules/Go-DTRules/pkg/vm"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/errors"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
 	"gitlab.com/accumulatenetwork/accumulate/protocol"
 )
 
 func FetchAmlCertID(ctx context.Context, client api.Querier, identity *url.URL) ([32]byte, error) {
 	// Get the latest entry for the identity's metadata
-	personalBank, err := fetchDataAs[any](ctx, client, identity.JoinPath("discoveryV1ClientDefault_personalbank", "Info_V1"), &api.DataQuery{})
+	personalBank, err := fetchDataAs[any](ctx, client, personalBankUrl(identity), &api.DataQuery{})
 	if err != nil {
 		return [32]byte{}, fmt.Errorf("fetch personal bank metadata: %w", err)
 	}
+	return certIDFromPersonalBank(personalBank)
+}
+
+func personalBankUrl(identity *url.URL) *url.URL {
+	return identity.JoinPath("discoveryV1ClientDefault_personalbank", "Info_V1")
+}
 
-	// Extract the certificate ID
+// certIDFromPersonalBank extracts the primary certificate ID from the
+// personal bank metadata.
+func certIDFromPersonalBank(personalBank any) ([32]byte, error) {
 	idStr, err := getJsonField[string](
 		personalBank,
 		objectField("segements"),
 		findValue("data").For(objectField("segmentType")),
 		objectField("config"),
 		objectField("dataItems"),
-		findValue("primaryAml").For(objectField("target")),
+		findValue(primaryTarget).For(objectField("target")),
 		objectField("certificateUrl"),
 	)
 	if err != nil {
 		return [32]byte{}, fmt.Errorf("locate certificate ID: %w", err)
 	}
+	return parseCertID(idStr)
+}
+
+func parseCertID(idStr string) ([32]byte, error) {
 	idStr = strings.TrimPrefix(idStr, "acc://")
 	idBytes, err := hex.DecodeString(idStr)
 	if err != nil {
@@ -45,7 +60,73 @@ func FetchAmlCertID(ctx context.Context, client api.Querier, identity *url.URL)
 	return [32]byte(idBytes), nil
 }
 
+// primaryTarget is the target of the personal bank data item that refers to
+// the identity's primary certificate.
+const primaryTarget = "primaryAml"
+
+// CertificateRef is a certificate the personal bank of an identity refers to.
+type CertificateRef struct {
+	// Target is the target of the data item, such as primaryAml.
+	Target string
+	ID     [32]byte
+}
+
+// FetchAmlCertIDs returns every certificate the identity's personal bank
+// refers to, that is every data item with a certificate URL. The primary
+// certificate is first, followed by the others in the order they are listed.
+func FetchAmlCertIDs(ctx context.Context, client api.Querier, identity *url.URL) ([]*CertificateRef, error) {
+	personalBank, err := fetchDataAs[any](ctx, client, personalBankUrl(identity), &api.DataQuery{})
+	if err != nil {
+		return nil, fmt.Errorf("fetch personal bank metadata: %w", err)
+	}
+	return certRefsFromPersonalBank(personalBank)
+}
+
+func certRefsFromPersonalBank(personalBank any) ([]*CertificateRef, error) {
+	items, err := getJsonField[[]any](
+		personalBank,
+		objectField("segements"),
+		findValue("data").For(objectField("segmentType")),
+		objectField("config"),
+		objectField("dataItems"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("locate certificate IDs: %w", err)
+	}
+
+	var refs []*CertificateRef
+	for _, item := range items {
+		item, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		idStr, ok := item["certificateUrl"].(string)
+		if !ok {
+			continue
+		}
+		target, _ := item["target"].(string)
+		id, err := parseCertID(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s: %w", target, err)
+		}
+		refs = append(refs, &CertificateRef{Target: target, ID: id})
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("locate certificate IDs: no certificates found")
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Target == primaryTarget && refs[j].Target != primaryTarget })
+	return refs, nil
+}
+
 func FetchAmlCert(ctx context.Context, client api.Querier, id [32]byte) (vm.Entity, error) {
+	cert, err := fetchAmlCertData(ctx, client, id)
+	if err != nil {
+		return nil, err
+	}
+	return NewCertificate(cert), nil
+}
+
+func fetchAmlCertData(ctx context.Context, client api.Querier, id [32]byte) (map[string]any, error) {
 	// Find the certificate entry
 	certData, err := fetchDataAs[any](ctx, client, protocol.UnknownUrl(), &api.MessageHashSearchQuery{Hash: id})
 	if err != nil {
@@ -64,7 +145,62 @@ func FetchAmlCert(ctx context.Context, client api.Querier, id [32]byte) (vm.Enti
 	if err != nil {
 		return nil, fmt.Errorf("locate certificate data: %w", err)
 	}
-	return &jEntity{"certificate", cert}, nil
+	return cert, nil
+}
+
+// NewCertificate returns a certificate entity for the decoded certificate
+// data.
+func NewCertificate(data map[string]any) vm.Entity {
+	return &jEntity{"certificate", data}
+}
+
+// FetchRuleset fetches a ruleset that has been published to a data account.
+// The entry must have been written to the account by a transaction that was
+// delivered, so publishing a ruleset is subject to the account's authorities.
+// The hash of the entry is verified before it is compiled. The first part of
+// the entry is the compiled EDD and the second is the compiled decision
+// tables. The entry is not proven when it is fetched, since a registry is
+// loaded before any anchors are known. Instead [Engine.Execute] proves it with
+// every request, up to the engine's trusted anchors.
+func FetchRuleset(ctx context.Context, client api.Querier, name, entry string, account *url.URL, hash [32]byte) (*Ruleset, error) {
+	Q := api.Querier2{Querier: client}
+	r, err := Q.QueryDataEntry(ctx, account, &api.DataQuery{Entry: hash[:]})
+	if err != nil {
+		return nil, fmt.Errorf("fetch ruleset %x from %v: %w", hash[:4], account, err)
+	}
+	if r.Value.Status != errors.Delivered {
+		return nil, fmt.Errorf("ruleset %x from %v: transaction status is %v", hash[:4], account, r.Value.Status)
+	}
+	return rulesetFromTransaction(name, entry, account, r.Value.Message.Transaction, hash)
+}
+
+// rulesetFromTransaction compiles the ruleset written to the account by a
+// delivered transaction.
+func rulesetFromTransaction(name, entry string, account *url.URL, txn *protocol.Transaction, hash [32]byte) (*Ruleset, error) {
+	if !txn.Header.Principal.Equal(account) {
+		return nil, fmt.Errorf("ruleset %x: entry was written to %v, not %v", hash[:4], txn.Header.Principal, account)
+	}
+
+	data, err := getDataEntry(txn)
+	if err != nil {
+		return nil, err
+	}
+	if got := data.Hash(); !bytes.Equal(got, hash[:]) {
+		return nil, fmt.Errorf("ruleset hash mismatch: want %x, got %x", hash, got)
+	}
+
+	parts := data.GetData()
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("ruleset %x: want 2 parts (EDD and decision tables), got %d", hash[:4], len(parts))
+	}
+
+	rs, err := compileRuleset(name, entry, hash, parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+	rs.Account = account
+	rs.txn = txn
+	return rs, nil
 }
 
 func fetchDataAs[V any](ctx context.Context, client api.Querier, account *url.URL, query api.Query) (V, error) {
@@ -73,12 +209,17 @@ func fetchDataAs[V any](ctx context.Context, client api.Querier, account *url.UR
 	var txn *protocol.Transaction
 	switch query := query.(type) {
 	case *api.DataQuery:
-		r, err := Q.QueryDataEntry(ctx, account, &api.DataQuery{})
+		r, err := Q.QueryDataEntry(ctx, account, query)
 		if err != nil {
 			var z V
 			return z, err
 		}
 		txn = r.Value.Message.Transaction
+		err = proveEntry(ctx, client, account, txn)
+		if err != nil {
+			var z V
+			return z, err
+		}
 
 	case *api.MessageHashSearchQuery:
 		r, err := Q.QueryTransaction(ctx, account.WithTxID(query.Hash), nil)
@@ -87,28 +228,46 @@ func fetchDataAs[V any](ctx context.Context, client api.Querier, account *url.UR
 			return z, err
 		}
 		txn = r.Message.Transaction
+		err = proveTransaction(ctx, client, query.Hash, txn)
+		if err != nil {
+			var z V
+			return z, err
+		}
 	}
 
-	var entry [][]byte
-	switch body := txn.Body.(type) {
-	case *protocol.WriteData:
-		entry = body.Entry.GetData()
-	case *protocol.SyntheticWriteData:
-		entry = body.Entry.GetData()
-	default:
+	return decodeDataEntry[V](txn)
+}
+
+// decodeDataEntry decodes the first part of the data entry written by the
+// transaction as JSON.
+func decodeDataEntry[V any](txn *protocol.Transaction) (V, error) {
+	data, err := getDataEntry(txn)
+	if err != nil {
 		var z V
-		return z, fmt.Errorf("invalid transaction: want data, got %v", body.Type())
+		return z, err
 	}
 
+	entry := data.GetData()
 	if len(entry) == 0 {
 		var z V
-		return z, fmt.Errorf("latest entry is empty")
+		return z, fmt.Errorf("entry is empty")
 	}
 
 	var v V
-	err := json.Unmarshal(entry[0], &v)
+	err = json.Unmarshal(entry[0], &v)
 	if err != nil {
 		return v, fmt.Errorf("cannot decode entry: %w", err)
 	}
 	return v, nil
 }
+
+func getDataEntry(txn *protocol.Transaction) (protocol.DataEntry, error) {
+	switch body := txn.Body.(type) {
+	case *protocol.WriteData:
+		return body.Entry, nil
+	case *protocol.SyntheticWriteData:
+		return body.Entry, nil
+	default:
+		return nil, fmt.Errorf("invalid transaction: want data, got %v", body.Type())
+	}
+}
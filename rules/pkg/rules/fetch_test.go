@@ -0,0 +1,106 @@
+package rules_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/errors"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/types/merkle"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/types/messaging"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+// entryQuerier answers every data entry query with the same entry.
+type entryQuerier struct {
+	txn    *protocol.Transaction
+	status errors.Status
+}
+
+func (q *entryQuerier) Query(_ context.Context, scope *url.URL, _ api.Query) (api.Record, error) {
+	return &api.ChainEntryRecord[api.Record]{
+		Account: scope,
+		Name:    "main",
+		Type:    merkle.ChainTypeTransaction,
+		Entry:   [32]byte(q.txn.GetHash()),
+		Value: &api.MessageRecord[messaging.Message]{
+			ID:      q.txn.ID(),
+			Message: &messaging.TransactionMessage{Transaction: q.txn},
+			Status:  q.status,
+		},
+	}, nil
+}
+
+func publishRuleset(t *testing.T, account *url.URL) (*entryQuerier, [32]byte) {
+	t.Helper()
+	edd, err := os.ReadFile("compiled_edd.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dt, err := os.ReadFile("compiled_dt.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &protocol.DoubleHashDataEntry{Data: [][]byte{edd, dt}}
+	txn := new(protocol.Transaction)
+	txn.Header.Principal = account
+	txn.Body = &protocol.WriteData{Entry: entry}
+	return &entryQuerier{txn: txn, status: errors.Delivered}, [32]byte(entry.Hash())
+}
+
+func TestFetchRuleset(t *testing.T) {
+	account := url.MustParse("aml.acme/policy")
+	q, hash := publishRuleset(t, account)
+
+	rs, err := rules.FetchRuleset(context.Background(), q, "onchain", rules.DefaultEntryPoint, account, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Hash != hash {
+		t.Fatalf("want hash %x, got %x", hash, rs.Hash)
+	}
+	if rs.Hash != rules.DefaultRuleset().Hash {
+		t.Fatalf("publishing the built-in ruleset should not change its hash")
+	}
+	if !rs.Account.Equal(account) {
+		t.Fatalf("want account %v, got %v", account, rs.Account)
+	}
+}
+
+func TestFetchRulesetRejects(t *testing.T) {
+	account := url.MustParse("aml.acme/policy")
+
+	cases := map[string]struct {
+		modify func(q *entryQuerier, hash *[32]byte)
+		error  string
+	}{
+		"wrong hash": {
+			modify: func(_ *entryQuerier, hash *[32]byte) { hash[0]++ },
+			error:  "hash mismatch",
+		},
+		"not delivered": {
+			modify: func(q *entryQuerier, _ *[32]byte) { q.status = errors.Pending },
+			error:  "transaction status",
+		},
+		"other account": {
+			modify: func(q *entryQuerier, _ *[32]byte) { q.txn.Header.Principal = url.MustParse("mallory.acme/policy") },
+			error:  "was written to",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			q, hash := publishRuleset(t, account)
+			c.modify(q, &hash)
+			_, err := rules.FetchRuleset(context.Background(), q, "onchain", rules.DefaultEntryPoint, account, hash)
+			if err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Fatalf("want error containing %q, got %v", c.error, err)
+			}
+		})
+	}
+}
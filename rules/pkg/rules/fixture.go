@@ -0,0 +1,321 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is a regression case for a ruleset: a certificate and the result
+// the ruleset is expected to produce for it. Fixtures are written as YAML or
+// JSON files. A YAML file may contain several fixtures separated by ---.
+//
+//	name: expired certificate
+//	asOf: 2024-06-01T00:00:00Z
+//	certificate:
+//	  certificationStatus: passed
+//	  toDate: 2024-01-01
+//	expect:
+//	  denied: true
+//	  denialReason: [Certificate has expired]
+type Fixture struct {
+	// Name defaults to the name of the file.
+	Name string `json:"name" yaml:"name"`
+
+	// File is the file the fixture was read from.
+	File string `json:"-" yaml:"-"`
+
+	// Ruleset is the name of the ruleset to execute. If it is empty the
+	// default ruleset is used.
+	Ruleset string `json:"ruleset" yaml:"ruleset"`
+
+	// AsOf is the time the certificate is evaluated at. If it is nil the
+	// engine's clock is used.
+	AsOf *time.Time `json:"asOf" yaml:"asOf"`
+
+	Certificate map[string]any `json:"certificate" yaml:"certificate"`
+
+	// Signers are the key pages that signed the certificate, if the ruleset
+	// only trusts certain issuers.
+	Signers []*Signer `json:"signers" yaml:"signers"`
+
+	// Certificates are the certificates of an identity that has several, the
+	// primary first. A fixture has either a certificate or certificates.
+	Certificates []*FixtureCertificate `json:"certificates" yaml:"certificates"`
+
+	// Aggregation overrides the ruleset's policy for combining the results
+	// of the certificates.
+	Aggregation Aggregation `json:"aggregation" yaml:"aggregation"`
+
+	// History is the transfer history of the identity, if the ruleset uses
+	// it.
+	History *History `json:"history" yaml:"history"`
+
+	Expect Expectation `json:"expect" yaml:"expect"`
+}
+
+// FixtureCertificate is one of the certificates of a fixture's identity.
+type FixtureCertificate struct {
+	Target      string         `json:"target" yaml:"target"`
+	Certificate map[string]any `json:"certificate" yaml:"certificate"`
+	Signers     []*Signer      `json:"signers" yaml:"signers"`
+}
+
+// UnmarshalYAML reads a signer of a fixture, whose URL is a string.
+func (s *Signer) UnmarshalYAML(n *yaml.Node) error {
+	var v struct {
+		URL  string    `yaml:"url"`
+		Time time.Time `yaml:"time"`
+	}
+	err := n.Decode(&v)
+	if err != nil {
+		return err
+	}
+	s.URL, err = url.Parse(v.URL)
+	if err != nil {
+		return fmt.Errorf("signer: %w", err)
+	}
+	s.Time = v.Time
+	return nil
+}
+
+// Expectation is the result a fixture expects. If DenialReason is nil or
+// RiskTier is empty they are not checked.
+type Expectation struct {
+	Denied       bool     `json:"denied" yaml:"denied"`
+	DenialReason []string `json:"denialReason" yaml:"denialReason"`
+	RiskTier     RiskTier `json:"riskTier" yaml:"riskTier"`
+}
+
+// FixtureResult is the outcome of running a fixture. Failures is empty if
+// the fixture passed.
+type FixtureResult struct {
+	Fixture  *Fixture
+	Result   *Result
+	Failures []string
+	Duration time.Duration
+}
+
+func (r *FixtureResult) Passed() bool { return len(r.Failures) == 0 }
+
+// LoadFixtures reads every .yaml, .yml, and .json file in the file system as
+// fixtures.
+func LoadFixtures(fsys fs.FS) ([]*Fixture, error) {
+	var fixtures []*Fixture
+	err := fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch path.Ext(file) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		f, err := parseFixtures(file, b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		fixtures = append(fixtures, f...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(fixtures) == 0 {
+		return nil, errors.New("no fixtures found")
+	}
+	return fixtures, nil
+}
+
+func parseFixtures(file string, b []byte) ([]*Fixture, error) {
+	var fixtures []*Fixture
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	for i := 0; ; i++ {
+		f := new(Fixture)
+		err := dec.Decode(f)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if (f.Certificate == nil) == (len(f.Certificates) == 0) {
+			return nil, fmt.Errorf("fixture %d must have either a certificate or certificates", i+1)
+		}
+
+		// Round-trip the certificates through JSON so they have the same
+		// types as certificates read from the network
+		if f.Certificate != nil {
+			f.Certificate, err = normalizeJSON(f.Certificate)
+		}
+		for j, c := range f.Certificates {
+			if c.Certificate == nil {
+				return nil, fmt.Errorf("fixture %d: certificate %d is empty", i+1, j+1)
+			}
+			if err == nil {
+				c.Certificate, err = normalizeJSON(c.Certificate)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fixture %d: %w", i+1, err)
+		}
+
+		f.File = file
+		if f.Name == "" {
+			f.Name = strings.TrimSuffix(file, path.Ext(file))
+			if i > 0 {
+				f.Name += fmt.Sprintf(" #%d", i+1)
+			}
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+func normalizeJSON(v map[string]any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var u map[string]any
+	err = json.Unmarshal(b, &u)
+	return u, err
+}
+
+// RunFixtures evaluates each fixture offline and compares the result with
+// its expectation.
+func (e *Engine) RunFixtures(ctx context.Context, fixtures []*Fixture) []*FixtureResult {
+	var results []*FixtureResult
+	for _, f := range fixtures {
+		results = append(results, e.RunFixture(ctx, f))
+	}
+	return results
+}
+
+// RunFixture evaluates a fixture offline and compares the result with its
+// expectation.
+func (e *Engine) RunFixture(ctx context.Context, f *Fixture) *FixtureResult {
+	r := &FixtureResult{Fixture: f}
+	req := &Request{Ruleset: f.Ruleset, AsOf: f.AsOf, Aggregation: f.Aggregation, History: f.History}
+	start := time.Now()
+	var err error
+	switch {
+	case f.Certificates != nil:
+		// EvaluateCertificates copies the certificates
+		var certs []*IdentityCertificate
+		for _, c := range f.Certificates {
+			certs = append(certs, &IdentityCertificate{Target: c.Target, Data: c.Certificate, Signers: c.Signers})
+		}
+		r.Result, err = e.EvaluateCertificates(ctx, req, certs)
+
+	case f.Signers != nil:
+		// Only certificates with signers can be checked against the
+		// ruleset's trusted issuers
+		cert := &IdentityCertificate{Target: primaryTarget, Data: f.Certificate, Signers: f.Signers}
+		r.Result, err = e.EvaluateCertificates(ctx, req, []*IdentityCertificate{cert})
+
+	default:
+		// The certificate is copied so the fixture can be run again
+		var cert map[string]any
+		cert, err = normalizeJSON(f.Certificate)
+		if err == nil {
+			r.Result, err = e.Evaluate(ctx, req, NewCertificate(cert))
+		}
+	}
+	r.Duration = time.Since(start)
+	if err != nil {
+		r.Failures = append(r.Failures, fmt.Sprintf("error: %v", err))
+		return r
+	}
+
+	if r.Result.Denied != f.Expect.Denied {
+		r.Failures = append(r.Failures, fmt.Sprintf("want denied=%v, got %v", f.Expect.Denied, r.Result.Denied))
+	}
+	if f.Expect.DenialReason != nil {
+		got := denialReasons(r.Result.DenialReason)
+		if !slices.Equal(got, f.Expect.DenialReason) {
+			r.Failures = append(r.Failures, fmt.Sprintf("want denialReason=%q, got %q", f.Expect.DenialReason, got))
+		}
+	}
+	if f.Expect.RiskTier != "" && r.Result.RiskTier != f.Expect.RiskTier {
+		r.Failures = append(r.Failures, fmt.Sprintf("want riskTier=%s, got %s", f.Expect.RiskTier, r.Result.RiskTier))
+	}
+	return r
+}
+
+func denialReasons(v any) []string {
+	reasons := []string{}
+	switch v := v.(type) {
+	case []any:
+		for _, v := range v {
+			reasons = append(reasons, fmt.Sprint(v))
+		}
+	case nil:
+	default:
+		reasons = append(reasons, fmt.Sprint(v))
+	}
+	return reasons
+}
+
+// WriteJUnit writes the results as a JUnit XML report.
+func WriteJUnit(w io.Writer, name string, results []*FixtureResult) error {
+	type failure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+	type testcase struct {
+		Name      string   `xml:"name,attr"`
+		Classname string   `xml:"classname,attr"`
+		Time      float64  `xml:"time,attr"`
+		Failure   *failure `xml:"failure,omitempty"`
+	}
+	type testsuite struct {
+		XMLName  xml.Name   `xml:"testsuite"`
+		Name     string     `xml:"name,attr"`
+		Tests    int        `xml:"tests,attr"`
+		Failures int        `xml:"failures,attr"`
+		Time     float64    `xml:"time,attr"`
+		Cases    []testcase `xml:"testcase"`
+	}
+
+	suite := testsuite{Name: name, Tests: len(results)}
+	for _, r := range results {
+		c := testcase{Name: r.Fixture.Name, Classname: r.Fixture.File, Time: r.Duration.Seconds()}
+		if !r.Passed() {
+			suite.Failures++
+			c.Failure = &failure{Message: r.Failures[0], Text: strings.Join(r.Failures, "\n")}
+		}
+		suite.Time += c.Time
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(suite)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
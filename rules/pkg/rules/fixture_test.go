@@ -0,0 +1,53 @@
+package rules_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules/rulestest"
+)
+
+func TestFixtures(t *testing.T) {
+	rulestest.Run(t, rules.NewEngine(rules.DefaultRegistry()), "testdata/fixtures")
+}
+
+func TestFixtureFailure(t *testing.T) {
+	fixtures, err := rules.LoadFixtures(fstest.MapFS{
+		"wrong.yaml": {Data: []byte(`
+asOf: 2024-06-01T00:00:00Z
+certificate:
+  certificationStatus: failed
+  dataOperationType: create
+  fromDate: 2024-01-01
+  toDate: 2025-01-01
+expect:
+  denied: false
+`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := rules.NewEngine(rules.DefaultRegistry()).RunFixtures(context.Background(), fixtures)
+	if len(results) != 1 || results[0].Passed() {
+		t.Fatalf("expected the fixture to fail")
+	}
+	if results[0].Fixture.Name != "wrong" {
+		t.Fatalf("want the name to default to the file name, got %q", results[0].Fixture.Name)
+	}
+
+	buf := new(bytes.Buffer)
+	err = rules.WriteJUnit(buf, "rules", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`tests="1"`, `failures="1"`, `<testcase name="wrong" classname="wrong.yaml"`, `want denied=false, got true`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want report to contain %q, got\n%s", want, buf)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package rules_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+// testFiles returns the files of a ruleset with the built-in EDD and the
+// given decision tables. Other files are given as pairs of names and
+// contents, such as "ruleset.json", `{"aggregation": "any-valid"}`, and may
+// replace the EDD.
+func testFiles(t *testing.T, dt string, files ...string) fstest.MapFS {
+	t.Helper()
+	edd, err := os.ReadFile("compiled_edd.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files)%2 != 0 {
+		t.Fatal("want pairs of file names and contents")
+	}
+
+	fsys := fstest.MapFS{
+		"compiled_edd.xml": {Data: edd},
+		"compiled_dt.xml":  {Data: []byte(dt)},
+	}
+	for i := 0; i < len(files); i += 2 {
+		fsys[files[i]] = &fstest.MapFile{Data: []byte(files[i+1])}
+	}
+	return fsys
+}
+
+// testRuleset compiles the files returned by [testFiles].
+func testRuleset(t *testing.T, dt string, files ...string) *rules.Ruleset {
+	t.Helper()
+	rs, err := rules.LoadRuleset(context.Background(), nil, rules.DefaultRulesetName, testFiles(t, dt, files...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func must1[V any](v V, err error) V {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,318 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	errors2 "gitlab.com/accumulatenetwork/accumulate/pkg/errors"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+// History holds rolling aggregates of the transfers of one token an identity
+// sent before the time of a request. The largest transfer and the
+// counterparties are taken over the longest window. Sums are in base units,
+// like the amounts of the transfers, so transfers of different tokens are
+// never added together.
+type History struct {
+	// Token is the address of the token contract of the transfers that are
+	// aggregated, or empty for transfers that do not name a token.
+	Token string `json:"token,omitempty" yaml:"token"`
+
+	Count24h       int      `json:"transferCount24h" yaml:"transferCount24h"`
+	Sum24h         *big.Int `json:"transferSum24h" yaml:"transferSum24h"`
+	Count7d        int      `json:"transferCount7d" yaml:"transferCount7d"`
+	Sum7d          *big.Int `json:"transferSum7d" yaml:"transferSum7d"`
+	Count30d       int      `json:"transferCount30d" yaml:"transferCount30d"`
+	Sum30d         *big.Int `json:"transferSum30d" yaml:"transferSum30d"`
+	Largest        *big.Int `json:"largestTransfer" yaml:"largestTransfer"`
+	Counterparties int      `json:"counterparties" yaml:"counterparties"`
+
+	// Transfers are the transfers the identity sent, and Incoming those its
+	// counterparties sent to it. They are used to detect structuring.
+	Transfers []*Transfer `json:"transfers,omitempty" yaml:"transfers"`
+	Incoming  []*Transfer `json:"incoming,omitempty" yaml:"incoming"`
+}
+
+// historyFields are the fields of the history entity.
+var historyFields = []string{
+	"transferCount24h", "transferSum24h",
+	"transferCount7d", "transferSum7d",
+	"transferCount30d", "transferSum30d",
+	"largestTransfer", "counterparties",
+}
+
+// historyWindow is the longest window of the history.
+const historyWindow = 30 * 24 * time.Hour
+
+// Transfer is a transfer recorded in an identity's chain of commands. The
+// amount is in the token's base units.
+type Transfer struct {
+	Time      time.Time `json:"time" yaml:"time"`
+	Sender    string    `json:"sender" yaml:"sender"`
+	Recipient string    `json:"recipient" yaml:"recipient"`
+	Token     string    `json:"token,omitempty" yaml:"token"`
+	Amount    *big.Int  `json:"amount" yaml:"amount"`
+}
+
+// of returns true if the transfer is of the token.
+func (t *Transfer) of(token string) bool {
+	return strings.EqualFold(strings.TrimSpace(t.Token), strings.TrimSpace(token))
+}
+
+func (h *History) add(t *Transfer, asOf time.Time, counterparties map[string]bool) {
+	age := asOf.Sub(t.Time)
+	if age < 0 || age > historyWindow || !t.of(h.Token) {
+		return
+	}
+	if age <= 24*time.Hour {
+		h.Count24h++
+		h.Sum24h.Add(h.Sum24h, t.Amount)
+	}
+	if age <= 7*24*time.Hour {
+		h.Count7d++
+		h.Sum7d.Add(h.Sum7d, t.Amount)
+	}
+	h.Count30d++
+	h.Sum30d.Add(h.Sum30d, t.Amount)
+	if t.Amount.Cmp(h.Largest) > 0 {
+		h.Largest.Set(t.Amount)
+	}
+	if r := strings.ToLower(t.Recipient); r != "" && !counterparties[r] {
+		counterparties[r] = true
+		h.Counterparties++
+	}
+}
+
+// NewHistory aggregates the transfers of the token the identity sent as of
+// the time. The history keeps every transfer, of any token, to detect round
+// trips.
+func NewHistory(transfers []*Transfer, asOf time.Time, token string) *History {
+	h := &History{
+		Token:     token,
+		Sum24h:    new(big.Int),
+		Sum7d:     new(big.Int),
+		Sum30d:    new(big.Int),
+		Largest:   new(big.Int),
+		Transfers: transfers,
+	}
+	counterparties := map[string]bool{}
+	for _, t := range transfers {
+		h.add(t, asOf, counterparties)
+	}
+	return h
+}
+
+// historyEntity is the history entity. The engine makes the history
+// available to the structuring operators while it is in use.
+type historyEntity struct {
+	*jEntity
+	history *History
+}
+
+func (h *History) entity() vm.Entity {
+	return &historyEntity{history: h, jEntity: &jEntity{"history", map[string]any{
+		"transferCount24h": h.Count24h,
+		"transferSum24h":   baseUnits(h.Sum24h),
+		"transferCount7d":  h.Count7d,
+		"transferSum7d":    baseUnits(h.Sum7d),
+		"transferCount30d": h.Count30d,
+		"transferSum30d":   baseUnits(h.Sum30d),
+		"largestTransfer":  baseUnits(h.Largest),
+		"counterparties":   h.Counterparties,
+	}}}
+}
+
+func chainOfCommandsUrl(identity *url.URL) *url.URL {
+	return identity.JoinPath("discoveryV1ClientDefault_chainofcommands", "Command_V1")
+}
+
+// FetchTransfers returns the transfers the identity recorded in its chain of
+// commands in the window before the time, the most recent first. Entries that
+// are not transfers are ignored.
+//
+// Only the main chain of the Command_V1 account is walked. Every entry of the
+// account, whether the identity wrote it or another account wrote it with
+// WriteDataTo, is a transaction on that chain with the time of its block, so
+// no entry is missed. Transfers the client did not record, such as those sent
+// directly on an EVM chain, are not part of the history.
+func FetchTransfers(ctx context.Context, client api.Querier, identity *url.URL, asOf time.Time, window time.Duration) ([]*Transfer, error) {
+	var transfers []*Transfer
+	account := chainOfCommandsUrl(identity)
+	err := walkDataEntries(ctx, client, account, true, func(entry *historicalEntry) bool {
+		if entry.ref.Time.After(asOf) {
+			return true
+		}
+		if entry.ref.Time.Before(asOf.Add(-window)) {
+			return false
+		}
+		cmd, err := decodeCommand(entry.txn)
+		if err != nil {
+			return true
+		}
+		transfers = append(transfers, transfersFromCommand(cmd, identity, *entry.ref.Time)...)
+		return true
+	})
+	switch {
+	case err == nil:
+		return transfers, nil
+	case errors.Is(err, errors2.NotFound):
+		// An identity that never issued a command has no chain of commands
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("fetch chain of commands: %w", err)
+	}
+}
+
+// FetchHistory computes the history of the identity's transfers of the token
+// as of the time.
+func FetchHistory(ctx context.Context, client api.Querier, identity *url.URL, asOf time.Time, token string) (*History, error) {
+	transfers, err := FetchTransfers(ctx, client, identity, asOf, historyWindow)
+	if err != nil {
+		return nil, err
+	}
+	return NewHistory(transfers, asOf, token), nil
+}
+
+// decodeCommand decodes a chain of commands entry, keeping numbers as
+// [json.Number] so amounts are not rounded.
+func decodeCommand(txn *protocol.Transaction) (any, error) {
+	raw, err := decodeDataEntry[json.RawMessage](txn)
+	if err != nil {
+		return nil, err
+	}
+	var cmd any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	err = dec.Decode(&cmd)
+	return cmd, err
+}
+
+// transfersFromCommand returns the data items of a chain of commands entry
+// that have a transfer amount. Amounts that are not integers in base units
+// are ignored, since such a transfer cannot be screened.
+func transfersFromCommand(cmd any, sender *url.URL, at time.Time) []*Transfer {
+	items, err := getJsonField[[]any](
+		cmd,
+		objectField("segements"),
+		findValue("data").For(objectField("segmentType")),
+		objectField("config"),
+		objectField("dataItems"),
+	)
+	if err != nil {
+		return nil
+	}
+
+	var transfers []*Transfer
+	for _, item := range items {
+		item, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		var s string
+		switch v := item["paramAmount"].(type) {
+		case json.Number:
+			s = v.String()
+		case string:
+			s = v
+		default:
+			continue
+		}
+		amount, err := parseAmount(s)
+		if err != nil {
+			continue
+		}
+		recipient, _ := item["paramReceipientEvmAddress"].(string)
+		token, _ := item["paramEvmTokenAddress"].(string)
+		transfers = append(transfers, &Transfer{Time: at, Sender: sender.String(), Recipient: recipient, Token: token, Amount: amount})
+	}
+	return transfers
+}
+
+// usesHistory returns true if any of the ruleset's tables refer to a field of
+// the history entity or to a structuring operator.
+func (rs *Ruleset) usesHistory() bool {
+	return rs.uses(slices.Concat(historyFields, structuringOperatorNames)...)
+}
+
+// uses returns true if any of the ruleset's tables refer to one of the names.
+func (rs *Ruleset) uses(names ...string) bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+
+	var uses bool
+	_ = forEachTable(rs.Tables, func(_ string, table *dt.DecisionTable) error {
+		for _, stmts := range [][]vm.Value{table.Before, table.Conditions, table.Actions} {
+			for _, stmt := range stmts {
+				walkStatement(stmt, func(v vm.Value) {
+					switch v := v.(type) {
+					case vm.ExecutableName:
+						uses = uses || set[strings.ToLower(v.Name())]
+					case vm.CompoundName:
+						uses = uses || set[strings.ToLower(v.Member.Name())]
+					}
+				})
+			}
+		}
+		return nil
+	})
+	return uses
+}
+
+// history returns the history entity of the identity, if the ruleset uses it.
+// The request's history takes precedence. Without a client, the request must
+// provide the history. When screening a transaction, the history is of the
+// transaction's token. Otherwise it is of the ruleset's history token, which
+// must be configured.
+func (e *Engine) history(ctx context.Context, client api.Querier, rs *Ruleset, req *Request, identity *url.URL) ([]vm.Entity, error) {
+	switch {
+	case req.History != nil:
+		return []vm.Entity{req.History.entity()}, nil
+	case !rs.usesHistory():
+		return nil, nil
+	case client == nil:
+		return nil, errors.New("the ruleset uses the transfer history, which must be provided to evaluate offline")
+	}
+
+	token := rs.HistoryToken
+	if req.Transaction != nil {
+		token = req.Transaction.Token
+	} else if token == "" {
+		return nil, fmt.Errorf("the ruleset uses the transfer history, so screening an identity requires historyToken in %s", configFile)
+	}
+	h, err := FetchHistory(ctx, client, identity, *req.AsOf, token)
+	if err != nil {
+		return nil, err
+	}
+	if rs.uses(opRoundTrips.Name) {
+		h.Incoming, err = fetchIncoming(ctx, client, identity, h.Transfers, *req.AsOf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []vm.Entity{h.entity()}, nil
+}
+
+// withTime returns the request with AsOf set to the engine's time if it is
+// not set, so every part of the request is evaluated as of the same time.
+func (e *Engine) withTime(req *Request) *Request {
+	if req.AsOf != nil {
+		return req
+	}
+	r := *req
+	now := e.Clock().Now()
+	r.AsOf = &now
+	return &r
+}
@@ -0,0 +1,135 @@
+package rules_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+func TestHistory(t *testing.T) {
+	q := newHistoryQuerier()
+	identity := url.MustParse("alice.acme")
+	commands := identity.JoinPath("discoveryV1ClientDefault_chainofcommands", "Command_V1")
+	transferOf := func(block uint64, recipient, token, amount string) {
+		q.write(commands, block, must1(json.Marshal(map[string]any{
+			"segements": []any{map[string]any{"segmentType": "data", "config": map[string]any{"dataItems": []any{map[string]any{
+				"commandType":               "transfer",
+				"paramSenderAdiUrl":         identity.String(),
+				"paramReceipientEvmAddress": recipient,
+				"paramEvmTokenAddress":      token,
+				"paramAmount":               amount,
+			}}}}},
+		})))
+	}
+	transfer := func(block uint64, recipient, amount string) {
+		transferOf(block, recipient, "", amount)
+	}
+
+	// Blocks are an hour apart, so block 720 is 30 days after block 0
+	q.writeCertificate(identity, 0, map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	})
+	transfer(1, "bob.acme", "100")
+	transfer(600, "carol.acme", "200")
+	transfer(700, "bob.acme", "300")
+	q.write(commands, 705, []byte(`{"note": "not a transfer"}`))
+	transfer(710, "dave.acme", "400")
+	transfer(715, "0x742d35Cc6634C0532925a3b844Bc454e4438f44e", "500")
+	transfer(730, "erin.acme", "600")
+	asOf := blockTime(720)
+
+	h, err := rules.FetchHistory(context.Background(), q, identity, asOf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rules.History{
+		Count24h: 3, Sum24h: big.NewInt(1200),
+		Count7d: 4, Sum7d: big.NewInt(1400),
+		Count30d: 5, Sum30d: big.NewInt(1500),
+		Largest: big.NewInt(500), Counterparties: 4,
+	}
+	if len(h.Transfers) != 5 {
+		t.Fatalf("want 5 transfers, got %d", len(h.Transfers))
+	}
+	h.Transfers = nil
+	if fmt.Sprint(*h) != fmt.Sprint(want) {
+		t.Fatalf("want %+v, got %+v", want, *h)
+	}
+
+	// Amounts are summed exactly in base units, and amounts that are not
+	// integers are ignored
+	transfer(716, "bob.acme", "9007199254740993")
+	transfer(717, "bob.acme", "1.5")
+	h = must1(rules.FetchHistory(context.Background(), q, identity, asOf, ""))
+	if h.Count24h != 4 || h.Sum24h.String() != "9007199254742193" || h.Largest.String() != "9007199254740993" {
+		t.Fatalf("want an exact sum, got %+v", *h)
+	}
+
+	// Transfers of a token are aggregated apart from the others
+	usdc := "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	transferOf(718, "carol.acme", usdc, "700")
+	h = must1(rules.FetchHistory(context.Background(), q, identity, asOf, ""))
+	if h.Count24h != 4 || h.Sum24h.String() != "9007199254742193" {
+		t.Fatalf("want the token's transfer left out, got %+v", *h)
+	}
+	h = must1(rules.FetchHistory(context.Background(), q, identity, asOf, strings.ToUpper(usdc)))
+	if h.Count24h != 1 || h.Sum24h.String() != "700" || h.Counterparties != 1 || len(h.Transfers) != 7 {
+		t.Fatalf("want only the token's transfer, got %+v", *h)
+	}
+
+	// A ruleset with a velocity limit on the token. Screening an identity
+	// needs the ruleset to name the token, since every recorded transfer
+	// names one.
+	velocity := `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>transferSum24h 500 &gt;</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>true /denied xdef "Velocity limit exceeded" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`
+	engine := rules.NewEngine(must1(rules.NewRegistry(testRuleset(t, velocity))))
+	_, err = engine.Execute(context.Background(), q, &rules.Request{Identity: identity, AsOf: &asOf})
+	if err == nil || !strings.Contains(err.Error(), "historyToken") {
+		t.Fatalf("want an error without a history token, got %v", err)
+	}
+
+	rs := testRuleset(t, velocity, "ruleset.json", fmt.Sprintf(`{"historyToken": %q}`, usdc))
+	engine = rules.NewEngine(must1(rules.NewRegistry(rs)))
+
+	res, err := engine.Execute(context.Background(), q, &rules.Request{Identity: identity, AsOf: &asOf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied || res.DenialReason.([]any)[0] != "Velocity limit exceeded" {
+		t.Fatalf("want denied by the velocity limit, got %v", res.DenialReason)
+	}
+
+	// Offline, the history must be provided
+	cert := rules.NewCertificate(map[string]any{"certificationStatus": "passed", "dataOperationType": "create", "fromDate": "2024-01-01", "toDate": "2030-01-01"})
+	_, err = engine.Evaluate(context.Background(), &rules.Request{AsOf: &asOf}, cert)
+	if err == nil {
+		t.Fatal("want an error without the history")
+	}
+	res, err = engine.Evaluate(context.Background(), &rules.Request{AsOf: &asOf, History: &rules.History{Sum24h: big.NewInt(500)}}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Denied {
+		t.Fatalf("want allowed under the limit, got %v", res.DenialReason)
+	}
+}
@@ -0,0 +1,251 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	errors2 "gitlab.com/accumulatenetwork/accumulate/pkg/errors"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/types/messaging"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+// TrustedIssuer is an authority whose signature makes a certificate
+// trustworthy.
+type TrustedIssuer struct {
+	// Authority is a key book, whose pages may sign. The pages of other books,
+	// including the books of the ADI's sub-ADIs, may not.
+	Authority *url.URL `json:"authority"`
+
+	// From and Until bound the time the authority is trusted. A certificate
+	// signed outside of it is not trusted. Either may be omitted.
+	From  *time.Time `json:"from,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// Signer is a key page that signed a certificate's transaction, and the time
+// the signature was recorded.
+type Signer struct {
+	URL  *url.URL  `json:"url" yaml:"url"`
+	Time time.Time `json:"time" yaml:"time"`
+}
+
+func (t *TrustedIssuer) trusts(s *Signer) bool {
+	if !t.Authority.ParentOf(s.URL) {
+		return false
+	}
+	if t.From != nil && s.Time.Before(*t.From) {
+		return false
+	}
+	return t.Until == nil || s.Time.Before(*t.Until)
+}
+
+// trustedSigner returns the first signer that belongs to one of the ruleset's
+// trusted issuers at the time it signed, or nil.
+func (rs *Ruleset) trustedSigner(signers []*Signer) *Signer {
+	for _, s := range signers {
+		for _, t := range rs.TrustedIssuers {
+			if t.trusts(s) {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// fetchIssuers fetches the signers of each certificate, if the ruleset only
+// trusts certain issuers.
+func fetchIssuers(ctx context.Context, client api.Querier, rs *Ruleset, certs []*IdentityCertificate) error {
+	if len(rs.TrustedIssuers) == 0 {
+		return nil
+	}
+	for _, c := range certs {
+		var err error
+		c.Signers, err = FetchSigners(ctx, client, c.ID)
+		if err != nil {
+			return fmt.Errorf("certificate %s: %w", c.Target, err)
+		}
+	}
+	return nil
+}
+
+// FetchSigners returns the key pages that signed a certificate's transaction,
+// with the time each signature was recorded on the signer's signature chain.
+// Only delivered key signatures whose key was on the page at the version it
+// signed with are returned. Their signature chain entries are proven if the
+// context requires it.
+func FetchSigners(ctx context.Context, client api.Querier, id [32]byte) ([]*Signer, error) {
+	Q := api.Querier2{Querier: client}
+	r, err := Q.QueryTransaction(ctx, protocol.UnknownUrl().WithTxID(id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch certificate signatures: %w", err)
+	}
+	if r.Signatures == nil {
+		return nil, nil
+	}
+
+	var signers []*Signer
+	for _, set := range r.Signatures.Records {
+		if set.Signatures == nil {
+			continue
+		}
+		for _, rec := range set.Signatures.Records {
+			msg, ok := rec.Message.(*messaging.SignatureMessage)
+			if !ok || rec.Status != errors2.Delivered {
+				continue
+			}
+			sig, ok := msg.Signature.(protocol.KeySignature)
+			if !ok {
+				continue
+			}
+
+			// The hash is computed locally so a proof covers the signature
+			// that was returned
+			signer := sig.GetSigner()
+			hash := msg.Hash()
+			entry, err := Q.QuerySignatureChainEntry(ctx, signer, &api.ChainQuery{Name: "signature", Entry: hash[:], IncludeReceipt: &api.ReceiptOptions{ForAny: true}})
+			if err != nil {
+				return nil, fmt.Errorf("fetch signature %x of %v: %w", hash, signer, err)
+			}
+			if entry.Receipt == nil {
+				return nil, fmt.Errorf("%v: the network did not return a receipt for signature %x", signer, hash)
+			}
+
+			keys, err := pageKeys(ctx, client, signer, sig.GetSignerVersion())
+			if err != nil {
+				return nil, fmt.Errorf("fetch the keys of %v: %w", signer, err)
+			}
+			if !keys[string(sig.GetPublicKeyHash())] {
+				continue
+			}
+			err = proveChainEntry(ctx, client, signer, "signature", hash[:])
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, &Signer{URL: signer, Time: entry.Receipt.LocalBlockTime})
+		}
+	}
+	return signers, nil
+}
+
+// pageKeys returns the hashes of the keys of the key page at the version, or
+// nil if the signer is not a key page or never had the version. Each
+// transaction that updates a page increments its version, so the keys at a
+// version are found by undoing the updates on the page's main chain, the
+// latest first. The updates are proven if the context requires it. The
+// page's current keys are read from the network, since the state of an
+// account cannot be proven without the network's state tree.
+func pageKeys(ctx context.Context, client api.Querier, signer *url.URL, version uint64) (map[string]bool, error) {
+	Q := api.Querier2{Querier: client}
+	r, err := Q.QueryAccount(ctx, signer, nil)
+	if err != nil {
+		return nil, err
+	}
+	page, ok := r.Account.(*protocol.KeyPage)
+	if !ok || version > page.Version {
+		return nil, nil
+	}
+	keys := map[string]bool{}
+	for _, k := range page.Keys {
+		keys[string(k.PublicKeyHash)] = true
+	}
+
+	updates := page.Version - version
+	if updates == 0 {
+		return keys, nil
+	}
+	err = walkMainChain(ctx, client, signer, func(rec *mainChainEntry) (bool, error) {
+		msg := rec.Value
+		if msg == nil || msg.Message == nil || msg.Status != errors2.Delivered {
+			return true, nil
+		}
+		txn := msg.Message.Transaction
+		switch body := txn.Body.(type) {
+		case *protocol.UpdateKeyPage:
+			for i := len(body.Operation) - 1; i >= 0; i-- {
+				switch op := body.Operation[i].(type) {
+				case *protocol.AddKeyOperation:
+					delete(keys, string(op.Entry.KeyHash))
+				case *protocol.RemoveKeyOperation:
+					keys[string(op.Entry.KeyHash)] = true
+				case *protocol.UpdateKeyOperation:
+					delete(keys, string(op.NewEntry.KeyHash))
+					keys[string(op.OldEntry.KeyHash)] = true
+				}
+			}
+
+		case *protocol.UpdateKey:
+			// The key that signed the update is the one it replaced
+			old, err := updatedKey(ctx, Q, signer, txn)
+			if err != nil {
+				return false, err
+			}
+			delete(keys, string(body.NewKeyHash))
+			keys[string(old)] = true
+
+		default:
+			return true, nil
+		}
+
+		err := proveEntry(ctx, client, signer, txn)
+		if err != nil {
+			return false, err
+		}
+		updates--
+		return updates > 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if updates > 0 {
+		return nil, fmt.Errorf("%d updates since version %d are missing from the main chain", updates, version)
+	}
+	return keys, nil
+}
+
+// updatedKey returns the hash of the key of the page that signed an UpdateKey
+// transaction.
+func updatedKey(ctx context.Context, Q api.Querier2, page *url.URL, txn *protocol.Transaction) ([]byte, error) {
+	r, err := Q.QueryTransaction(ctx, txn.ID(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch the signatures of %x: %w", txn.GetHash(), err)
+	}
+	if r.Signatures != nil {
+		for _, set := range r.Signatures.Records {
+			if set.Signatures == nil {
+				continue
+			}
+			for _, rec := range set.Signatures.Records {
+				msg, ok := rec.Message.(*messaging.SignatureMessage)
+				if !ok || rec.Status != errors2.Delivered {
+					continue
+				}
+				sig, ok := msg.Signature.(protocol.KeySignature)
+				if ok && sig.GetSigner().Equal(page) {
+					return sig.GetPublicKeyHash(), nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("no key of %v signed the update %x", page, txn.GetHash())
+}
+
+// untrustedResult denies a certificate that was not signed by a trusted
+// issuer, without executing the ruleset.
+func (e *Engine) untrustedResult(rs *Ruleset, req *Request) *Result {
+	const code = "ISSUER_UNTRUSTED"
+	rc, _ := reasonCodes.lookup(code)
+	res := &Result{
+		Denied:             true,
+		DenialReason:       []any{rc.Text},
+		RiskTier:           RiskProhibited,
+		RecommendedActions: []string{ActionDeny},
+		Ruleset:            rs.ref(),
+		AsOf:               *req.AsOf,
+		Locale:             e.Catalog().Negotiate(req.Locale),
+	}
+	res.Reasons = []*Reason{e.render(res.Locale, &Reason{Code: code}, rc.Text)}
+	return res
+}
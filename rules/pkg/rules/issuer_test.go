@@ -0,0 +1,150 @@
+package rules_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+func TestTrustedIssuers(t *testing.T) {
+	// The issuer's key book is trusted until block 100
+	files := testFiles(t, string(must1(os.ReadFile("compiled_dt.xml"))),
+		"ruleset.json", `{"trustedIssuers": [{"authority": "acc://issuer.acme/book", "until": "`+blockTime(100).Format(time.RFC3339)+`"}]}`)
+	rs, err := rules.LoadRuleset(context.Background(), nil, rules.DefaultRulesetName, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+
+	cert := map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	}
+	issuer := url.MustParse("issuer.acme/book/1")
+	self := url.MustParse("alice.acme/book/1")
+	subADI := url.MustParse("issuer.acme/anything/book/1")
+
+	// The page's keys are updated in block 50, after the certificate is
+	// signed with version 1 of the page
+	replaced := func(q *historyQuerier) {
+		q.keyPage(issuer, 2, "new")
+		q.update(issuer, 50, &protocol.UpdateKeyPage{Operation: []protocol.KeyPageOperation{
+			&protocol.UpdateKeyOperation{OldEntry: protocol.KeySpecParams{KeyHash: testKeyHash("old")}, NewEntry: protocol.KeySpecParams{KeyHash: testKeyHash("new")}},
+		}})
+	}
+	rotated := func(q *historyQuerier) {
+		q.keyPage(issuer, 2, "new")
+		txn := q.update(issuer, 50, &protocol.UpdateKey{NewKeyHash: testKeyHash("new")})
+		q.signWith(txn, issuer, "old", 1, 50)
+	}
+	added := func(q *historyQuerier) {
+		q.keyPage(issuer, 2, issuer.String(), "new")
+		q.update(issuer, 50, &protocol.UpdateKeyPage{Operation: []protocol.KeyPageOperation{
+			&protocol.AddKeyOperation{Entry: protocol.KeySpecParams{KeyHash: testKeyHash("new")}},
+		}})
+	}
+
+	cases := []struct {
+		name   string
+		signer *url.URL
+		key    string
+		block  uint64
+		page   func(*historyQuerier)
+		denied bool
+	}{
+		{"trusted", issuer, "", 10, nil, false},
+		{"self-issued", self, "", 10, nil, true},
+		{"issuer's sub-ADI", subADI, "", 10, func(q *historyQuerier) { q.keyPage(subADI, 1, subADI.String()) }, true},
+		{"signed after the issuer was trusted", issuer, "", 150, nil, true},
+		{"unsigned", nil, "", 10, nil, true},
+		{"not a key of the page", issuer, "mallory", 10, nil, true},
+		{"key replaced since", issuer, "old", 10, replaced, false},
+		{"key rotated since", issuer, "old", 10, rotated, false},
+		{"key added since", issuer, "new", 10, added, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := newHistoryQuerier()
+			q.keyPage(issuer, 1, issuer.String())
+			q.keyPage(self, 1, self.String())
+			if c.page != nil {
+				c.page(q)
+			}
+			identity := url.MustParse("alice.acme")
+			id := q.writeCertificate(identity, 10, cert)
+			if c.signer != nil && c.key == "" {
+				q.sign(id, c.signer, c.block)
+			} else if c.signer != nil {
+				q.signWith(id, c.signer, c.key, 1, c.block)
+			}
+
+			asOf := blockTime(200)
+			res, err := engine.Execute(context.Background(), q, &rules.Request{Identity: identity, AsOf: &asOf})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Denied != c.denied {
+				t.Fatalf("want denied=%v, got %v", c.denied, res.DenialReason)
+			}
+			if c.denied && (len(res.Reasons) != 1 || res.Reasons[0].Code != "ISSUER_UNTRUSTED") {
+				t.Fatalf("want an untrusted issuer, got %+v", res.Reasons)
+			}
+			if !c.denied && (res.Issuer == nil || !res.Issuer.URL.Equal(issuer) || !res.Issuer.Time.Equal(blockTime(c.block))) {
+				t.Fatalf("want the issuer recorded, got %+v", res.Issuer)
+			}
+		})
+	}
+
+	// With trusted anchors, the updates to the page and the signature are
+	// proven
+	q := newHistoryQuerier()
+	replaced(q)
+	identity := url.MustParse("alice.acme")
+	q.signWith(q.writeCertificate(identity, 10, cert), issuer, "old", 1, 10)
+	asOf := blockTime(200)
+	engine.SetAnchors([]*rules.Anchor{{Height: 60, Root: q.anchor(60)}})
+	res, err := engine.Execute(context.Background(), q, &rules.Request{Identity: identity, AsOf: &asOf})
+	engine.SetAnchors(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proven := func(chain string) bool {
+		return slices.ContainsFunc(res.Proofs, func(p *rules.Proof) bool { return p.Account.Equal(issuer) && p.Chain == chain })
+	}
+	if res.Denied || !proven("main") || !proven("signature") {
+		t.Fatalf("want an allowed result with proofs of the page's update and the signature, got %+v", res)
+	}
+
+	// Offline, the signers must be provided
+	res, err = engine.Evaluate(context.Background(), &rules.Request{AsOf: &asOf}, rules.NewCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied {
+		t.Fatal("want a certificate without signers denied")
+	}
+	res, err = engine.EvaluateCertificates(context.Background(), &rules.Request{AsOf: &asOf}, []*rules.IdentityCertificate{
+		{Target: "primaryAml", Data: cert, Signers: []*rules.Signer{{URL: issuer, Time: blockTime(10)}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Denied {
+		t.Fatalf("want allowed, got %v", res.DenialReason)
+	}
+
+	files["ruleset.json"] = &fstest.MapFile{Data: []byte(`{"trustedIssuers": [{"from": "2024-01-01T00:00:00Z"}]}`)}
+	_, err = rules.LoadRuleset(context.Background(), nil, rules.DefaultRulesetName, files)
+	if err == nil {
+		t.Fatal("want an error for an issuer without an authority")
+	}
+}
@@ -25,6 +25,28 @@ func (j *jEntity) Field(name vm.Name) (vm.Variable, bool) {
 	return &jVar{name.Name(), j.values}, true
 }
 
+// readOnlyEntity is a jEntity the tables cannot modify, for values that are
+// shared by several evaluations.
+type readOnlyEntity struct {
+	*jEntity
+}
+
+func (j readOnlyEntity) Field(name vm.Name) (vm.Variable, bool) {
+	v, ok := j.jEntity.Field(name)
+	if !ok {
+		return nil, false
+	}
+	return readOnlyVar{v.(*jVar)}, true
+}
+
+type readOnlyVar struct {
+	*jVar
+}
+
+func (j readOnlyVar) Store(vm.Value) error {
+	return fmt.Errorf("%s is read-only", j.name)
+}
+
 type jVar struct {
 	name   string
 	values map[string]any
@@ -57,7 +79,7 @@ func j2vm(name string, v any) (vm.Value, error) {
 		// [vm.Array] is not friendly to errors, so convert all the values now
 		a := make(vm.LiteralArray, len(v))
 		for i, v := range v {
-			v, err := vm.AsValue(v)
+			v, err := j2vm(name, v)
 			if err != nil {
 				return nil, fmt.Errorf("[%d]: %w", i, err)
 			}
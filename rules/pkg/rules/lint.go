@@ -0,0 +1,284 @@
+package rules
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+)
+
+// LintKind is the kind of problem found by [Lint].
+type LintKind string
+
+const (
+	// LintUnreachable is a case of a first-match table that can never fire
+	// because the cases before it match every input it matches.
+	LintUnreachable LintKind = "unreachable"
+
+	// LintOverlap is a pair of cases of an all-match table that can both fire
+	// for the same input.
+	LintOverlap LintKind = "overlap"
+
+	// LintIncomplete is a combination of condition results that no case
+	// matches, so the table does nothing.
+	LintIncomplete LintKind = "incomplete"
+
+	// LintUnused is a condition or action that no case uses.
+	LintUnused LintKind = "unused"
+
+	// LintUnknownName is a name that is not a field of the EDD, a decision
+	// table, or an operator.
+	LintUnknownName LintKind = "unknown-name"
+)
+
+// LintIssue is a problem found by [Lint]. Case, condition, and action numbers
+// are one-based.
+type LintIssue struct {
+	Table   string   `json:"table"`
+	Kind    LintKind `json:"kind"`
+	Message string   `json:"message"`
+}
+
+func (i *LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Table, i.Kind, i.Message)
+}
+
+// Lint statically analyses the decision tables of a ruleset. Conditions are
+// treated as independent, so a combination reported as incomplete may be
+// impossible in practice, for example if two conditions are mutually
+// exclusive.
+func Lint(rs *Ruleset) []*LintIssue {
+	names := map[string]bool{}
+	for _, def := range rs.Entities {
+		for name := range def {
+			names[strings.ToLower(name)] = true
+		}
+	}
+	for _, name := range slices.Concat(identityFields, transactionFields, evmAddressFields, historyFields) {
+		names[strings.ToLower(name)] = true
+	}
+
+	var issues []*LintIssue
+	_ = forEachTable(rs.Tables, func(name string, table *dt.DecisionTable) error {
+		report := func(kind LintKind, format string, args ...any) {
+			issues = append(issues, &LintIssue{Table: name, Kind: kind, Message: fmt.Sprintf(format, args...)})
+		}
+		lintCases(table, func(i int) int { return rs.caseNumber(name, i) }, report)
+		lintNames(table, names, rs.Tables, report)
+		return nil
+	})
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Table < issues[j].Table })
+	return issues
+}
+
+func lintCases(table *dt.DecisionTable, caseNumber func(int) int, report func(LintKind, string, ...any)) {
+	n := len(table.Conditions)
+	cubes := make([]cube, len(table.Cases))
+	for i, c := range table.Cases {
+		cubes[i] = make(cube, n)
+		if !c.Always {
+			copy(cubes[i], c.Conditions)
+		}
+	}
+
+	switch table.Mode {
+	case dt.ModeFirst:
+		for i := range cubes {
+			if len(subtractAll([]cube{cubes[i]}, cubes[:i])) == 0 {
+				report(LintUnreachable, "case %d can never fire because it is shadowed by earlier cases", caseNumber(i))
+			}
+		}
+
+	case dt.ModeAll:
+		for i := range cubes {
+			for j := i + 1; j < len(cubes); j++ {
+				if cubes[i].intersects(cubes[j]) {
+					report(LintOverlap, "cases %d and %d can both fire when %s", caseNumber(i), caseNumber(j), cubes[i].intersect(cubes[j]))
+				}
+			}
+		}
+	}
+
+	for _, c := range subtractAll([]cube{make(cube, n)}, cubes) {
+		report(LintIncomplete, "no case matches when %s", c)
+	}
+
+	usedCond := make([]bool, n)
+	usedAction := make([]bool, len(table.Actions))
+	for _, c := range table.Cases {
+		for i, v := range c.Conditions {
+			usedCond[i] = usedCond[i] || v != dt.DontCare
+		}
+		for _, a := range c.Actions {
+			if a < len(usedAction) {
+				usedAction[a] = true
+			}
+		}
+	}
+	for i, used := range usedCond {
+		if !used {
+			report(LintUnused, "condition %d is not used by any case", i+1)
+		}
+	}
+	for i, used := range usedAction {
+		if !used {
+			report(LintUnused, "action %d is not used by any case", i+1)
+		}
+	}
+}
+
+func lintNames(table *dt.DecisionTable, fields map[string]bool, tables vm.Entity, report func(LintKind, string, ...any)) {
+	// Names defined by the table itself, e.g. with def
+	defined := map[string]bool{}
+	stmts := map[string][]vm.Value{
+		"initial action": table.Before,
+		"condition":      table.Conditions,
+		"action":         table.Actions,
+	}
+	for _, stmts := range stmts {
+		for _, stmt := range stmts {
+			walkStatement(stmt, func(v vm.Value) {
+				if n, ok := v.(vm.LiteralName); ok {
+					defined[strings.ToLower(n.Name())] = true
+				}
+			})
+		}
+	}
+
+	known := func(name string) bool {
+		name = strings.ToLower(name)
+		if fields[name] || defined[name] {
+			return true
+		}
+		if _, ok := tables.Field(vm.LiteralName(name)); ok {
+			return true
+		}
+		_, ok := hostOperators.Get(name)
+		return ok
+	}
+
+	for _, kind := range []string{"initial action", "condition", "action"} {
+		for i, stmt := range stmts[kind] {
+			seen := map[string]bool{}
+			walkStatement(stmt, func(v vm.Value) {
+				var parts []string
+				switch v := v.(type) {
+				case vm.ExecutableName:
+					parts = []string{v.Name()}
+				case vm.CompoundName:
+					if v.Executable {
+						parts = []string{v.Entity.Name(), v.Member.Name()}
+					}
+				}
+				for _, name := range parts {
+					if !known(name) && !seen[name] {
+						seen[name] = true
+						report(LintUnknownName, "%s %d: %q is not an EDD field, decision table, or operator", kind, i+1, name)
+					}
+				}
+			})
+		}
+	}
+}
+
+// walkStatement calls the function for each value in the statement,
+// descending into procedures.
+func walkStatement(v vm.Value, fn func(vm.Value)) {
+	arr, ok := v.(vm.Array)
+	if !ok {
+		fn(v)
+		return
+	}
+	for i, n := 0, arr.Len(); i < n; i++ {
+		u := arr.Get(i)
+		if _, ok := u.(vm.Array); ok {
+			walkStatement(u, fn)
+		} else {
+			fn(u)
+		}
+	}
+}
+
+// cube is the set of inputs a case matches: each condition must be true,
+// false, or is not checked.
+type cube []dt.CaseCondition
+
+func (c cube) intersects(d cube) bool {
+	for i := range c {
+		if c[i] != dt.DontCare && d[i] != dt.DontCare && c[i] != d[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c cube) intersect(d cube) cube {
+	e := make(cube, len(c))
+	for i := range c {
+		e[i] = c[i]
+		if e[i] == dt.DontCare {
+			e[i] = d[i]
+		}
+	}
+	return e
+}
+
+// subtract returns the inputs that are in c but not in d, as disjoint cubes.
+func (c cube) subtract(d cube) []cube {
+	if !c.intersects(d) {
+		return []cube{c}
+	}
+	var out []cube
+	rest := append(cube(nil), c...)
+	for i := range rest {
+		if d[i] == dt.DontCare || rest[i] != dt.DontCare {
+			continue
+		}
+		e := append(cube(nil), rest...)
+		e[i] = opposite(d[i])
+		out = append(out, e)
+		rest[i] = d[i]
+	}
+	return out
+}
+
+func subtractAll(cs, ds []cube) []cube {
+	for _, d := range ds {
+		var next []cube
+		for _, c := range cs {
+			next = append(next, c.subtract(d)...)
+		}
+		cs = next
+		if len(cs) == 0 {
+			break
+		}
+	}
+	return cs
+}
+
+func opposite(c dt.CaseCondition) dt.CaseCondition {
+	if c == dt.True {
+		return dt.False
+	}
+	return dt.True
+}
+
+func (c cube) String() string {
+	var parts []string
+	for i, v := range c {
+		switch v {
+		case dt.True:
+			parts = append(parts, fmt.Sprintf("condition %d is true", i+1))
+		case dt.False:
+			parts = append(parts, fmt.Sprintf("condition %d is false", i+1))
+		}
+	}
+	if len(parts) == 0 {
+		return "any input"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,114 @@
+package rules_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+// lintRuleset builds a ruleset with a single table. Each condition is a
+// postfix expression followed by the cases it is checked in, e.g. "x 1=Y 2=N".
+func lintRuleset(t *testing.T, mode string, conditions ...string) *rules.Ruleset {
+	t.Helper()
+	var conds, actions strings.Builder
+	cases := map[string]bool{}
+	for i, c := range conditions {
+		fields := strings.Fields(c)
+		var cols strings.Builder
+		for _, f := range fields[1:] {
+			n, v, _ := strings.Cut(f, "=")
+			cases[n] = true
+			fmt.Fprintf(&cols, `<condition_column column_number="%s" column_value="%s"></condition_column>`, n, v)
+		}
+		fmt.Fprintf(&conds, `<condition_details><condition_number>%d</condition_number><condition_postfix>%s</condition_postfix>%s</condition_details>`, i+1, fields[0], cols.String())
+	}
+	fmt.Fprint(&actions, `<action_details><action_number>1</action_number><action_postfix>true cvb /denied xdef</action_postfix>`)
+	for n := range cases {
+		fmt.Fprintf(&actions, `<action_column column_number="%s" column_value="X"></action_column>`, n)
+	}
+	fmt.Fprint(&actions, `</action_details>`)
+
+	return testRuleset(t, fmt.Sprintf(`<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<attribute_fields><TYPE>%s</TYPE></attribute_fields>
+<conditions>%s</conditions>
+<actions>%s</actions>
+</decision_table></decision_tables>`, mode, conds.String(), actions.String()))
+}
+
+func TestLint(t *testing.T) {
+	cases := map[string]struct {
+		ruleset func(t *testing.T) *rules.Ruleset
+		issues  []string
+	}{
+		"built-in": {
+			// The shipped rules lint clean, so rules lint exits with 0
+			ruleset: func(*testing.T) *rules.Ruleset { return rules.DefaultRuleset() },
+		},
+		"unreachable": {
+			ruleset: func(t *testing.T) *rules.Ruleset {
+				return lintRuleset(t, "FIRST", "denied 1=Y 2=Y 3=N", "certificationStatus 2=Y")
+			},
+			issues: []string{
+				"unreachable: case 2 can never fire",
+			},
+		},
+		"disjoint": {
+			ruleset: func(t *testing.T) *rules.Ruleset {
+				return lintRuleset(t, "ALL", "denied 1=Y 2=N", "certificationStatus 1=N 2=Y")
+			},
+			issues: []string{
+				"incomplete: no case matches when condition 1 is false, condition 2 is false",
+				"incomplete: no case matches when condition 1 is true, condition 2 is true",
+			},
+		},
+		"overlap": {
+			ruleset: func(t *testing.T) *rules.Ruleset {
+				return lintRuleset(t, "ALL", "denied 1=Y 3=N", "certificationStatus 2=Y 3=N")
+			},
+			issues: []string{
+				"overlap: cases 1 and 2 can both fire when condition 1 is true, condition 2 is true",
+			},
+		},
+		"source columns": {
+			ruleset: func(t *testing.T) *rules.Ruleset {
+				return lintRuleset(t, "ALL", "denied 5=Y 6=N", "certificationStatus 3=Y 6=N")
+			},
+			issues: []string{
+				"overlap: cases 3 and 5 can both fire when condition 1 is true, condition 2 is true",
+			},
+		},
+		"unknown name": {
+			ruleset: func(t *testing.T) *rules.Ruleset {
+				return lintRuleset(t, "FIRST", "riskLevel 1=Y 2=N")
+			},
+			issues: []string{
+				`unknown-name: condition 1: "riskLevel" is not an EDD field`,
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			issues := rules.Lint(c.ruleset(t))
+			var got []string
+			for _, issue := range issues {
+				got = append(got, issue.String())
+			}
+			if len(got) != len(c.issues) {
+				t.Fatalf("want %d issues, got %q", len(c.issues), got)
+			}
+			for _, want := range c.issues {
+				var found bool
+				for _, got := range got {
+					found = found || strings.Contains(got, want)
+				}
+				if !found {
+					t.Errorf("want an issue containing %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package rules
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+)
+
+// AnyType can be used in an operator's signature to accept a value of any
+// type.
+const AnyType vm.Type = -1
+
+// Operator is a host function that decision tables can call by name.
+type Operator struct {
+	Name string
+
+	// Args are the types of the values the operator consumes from the data
+	// stack, deepest first. Results are the types of the values it pushes.
+	// Null is accepted for any type.
+	Args    []vm.Type
+	Results []vm.Type
+
+	// Fn implements the operator. Fn is responsible for popping its arguments
+	// and pushing its results.
+	Fn func(vm.State) error
+}
+
+// RegisterOperator makes an operator available to decision tables. The name
+// is not case sensitive and must not be the name of an operator built into
+// the VM. Decision tables are checked against the operator's signature when
+// they are compiled, so operators must be registered before the rulesets that
+// use them are loaded.
+func RegisterOperator(op Operator) error {
+	return hostOperators.register(op)
+}
+
+// operatorRegistry exposes host operators to decision tables. It is pushed
+// onto the bottom of the entity stack so that [vm.Resolve] falls back to it
+// when a name is not a field of any other entity and is not built into the
+// VM.
+type operatorRegistry struct {
+	mu  sync.RWMutex
+	ops map[string]*Operator
+}
+
+var _ vm.Entity = (*operatorRegistry)(nil)
+
+var hostOperators = newOperatorRegistry(slices.Concat(dateOperators, structuringOperators, sanctionsOperators, []Operator{opEqualsIgnoreCase})...)
+
+var opEqualsIgnoreCase = Operator{
+	Name:    "equalsIgnoreCase",
+	Args:    []vm.Type{AnyType, AnyType},
+	Results: []vm.Type{vm.BooleanType},
+	Fn: func(s vm.State) error {
+		v, err := s.Data().Pop(2)
+		if err != nil {
+			return err
+		}
+		x, err := vm.AsString(v[0])
+		if err != nil {
+			return err
+		}
+		y, err := vm.AsString(v[1])
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(x, y) {
+			return s.Data().Push(vm.True)
+		}
+		return s.Data().Push(vm.False)
+	},
+}
+
+func newOperatorRegistry(ops ...Operator) *operatorRegistry {
+	r := &operatorRegistry{ops: map[string]*Operator{}}
+	for _, op := range ops {
+		must(r.register(op))
+	}
+	return r
+}
+
+func (*operatorRegistry) EntityName() string { return "Operators" }
+
+func (r *operatorRegistry) Field(name vm.Name) (vm.Variable, bool) {
+	op, ok := r.Get(name.Name())
+	if !ok {
+		return nil, false
+	}
+	return vm.ReadOnlyVariable{Value: vm.Function(op.call)}, true
+}
+
+func (r *operatorRegistry) register(op Operator) error {
+	if op.Fn == nil {
+		return fmt.Errorf("operator %q has no implementation", op.Name)
+	}
+
+	// The VM resolves built-in operators when a table is compiled so a host
+	// operator with the same name would never be called
+	v, err := vm.CompileString(op.Name)
+	if err != nil {
+		return fmt.Errorf("invalid operator name %q: %w", op.Name, err)
+	}
+	if a := *v.(*vm.ExecutableArray); len(a) != 1 || !is[vm.ExecutableName](a[0]) {
+		return fmt.Errorf("invalid operator name %q: conflicts with a built-in operator or is not a simple name", op.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := strings.ToLower(op.Name)
+	if _, ok := r.ops[key]; ok {
+		return fmt.Errorf("operator %q is already registered", op.Name)
+	}
+	r.ops[key] = &op
+	return nil
+}
+
+func (r *operatorRegistry) Get(name string) (*Operator, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	op, ok := r.ops[strings.ToLower(name)]
+	return op, ok
+}
+
+// call verifies the arguments on the stack match the operator's signature
+// and calls it.
+func (op *Operator) call(s vm.State) error {
+	n := s.Data().Depth()
+	if n < len(op.Args) {
+		return fmt.Errorf("%s: want %d arguments, got %d", op.Name, len(op.Args), n)
+	}
+	for i, want := range op.Args {
+		v := s.Data().Peek(n - len(op.Args) + i)
+		if !typeMatches(want, v.Type()) {
+			return fmt.Errorf("%s: argument %d: want %v, got %v", op.Name, i+1, typeName(want), typeName(v.Type()))
+		}
+	}
+	return op.Fn(s)
+}
+
+func typeMatches(want, got vm.Type) bool {
+	return want == AnyType || got == AnyType || got == vm.NullType || want == got
+}
+
+func typeName(typ vm.Type) string {
+	switch typ {
+	case AnyType:
+		return "any"
+	case vm.NullType:
+		return "null"
+	case vm.NameType:
+		return "name"
+	case vm.NumberType:
+		return "number"
+	case vm.BooleanType:
+		return "boolean"
+	case vm.DateTimeType:
+		return "date"
+	case vm.StringType:
+		return "string"
+	case vm.ArrayType:
+		return "array"
+	case vm.FunctionType:
+		return "function"
+	case dt.EntityType:
+		return "entity"
+	}
+	return fmt.Sprintf("type(%d)", typ)
+}
+
+func is[V any](v any) bool {
+	_, ok := v.(V)
+	return ok
+}
+
+// checkOperators verifies that every call to a host operator in the decision
+// tables is given the number and types of arguments the operator declares.
+// Each statement is checked by tracking the types of the values it pushes.
+// Where the effect of a statement on the stack cannot be determined, such as
+// after calling a built-in operator or executing a table, the values below
+// that point are treated as unknown.
+func checkOperators(entities map[string]dt.EntityDefinition, tables vm.Entity) error {
+	fields := map[string]vm.Type{}
+	for _, def := range entities {
+		for name, f := range def {
+			name = strings.ToLower(name)
+			if typ, ok := fields[name]; ok && typ != f.Type {
+				fields[name] = AnyType
+			} else {
+				fields[name] = f.Type
+			}
+		}
+	}
+
+	return forEachTable(tables, func(name string, table *dt.DecisionTable) error {
+		check := func(kind string, stmts []vm.Value) error {
+			for i, stmt := range stmts {
+				err := checkStatement(stmt, fields, tables)
+				if err != nil {
+					return fmt.Errorf("table %s %s %d: %w", name, kind, i+1, err)
+				}
+			}
+			return nil
+		}
+		if err := check("initial action", table.Before); err != nil {
+			return err
+		}
+		if err := check("condition", table.Conditions); err != nil {
+			return err
+		}
+		return check("action", table.Actions)
+	})
+}
+
+func checkStatement(stmt vm.Value, fields map[string]vm.Type, tables vm.Entity) error {
+	var stack []vm.Type
+	unknown := false // Whether there may be values below the stack
+	reset := func() { stack, unknown = stack[:0], true }
+
+	arr, ok := stmt.(vm.Array)
+	if !ok {
+		return nil
+	}
+	for i, n := 0, arr.Len(); i < n; i++ {
+		switch v := arr.Get(i).(type) {
+		case vm.ExecutableName:
+			if typ, ok := fields[strings.ToLower(v.Name())]; ok {
+				stack = append(stack, typ)
+				continue
+			}
+			if _, ok := tables.Field(v); ok {
+				reset()
+				continue
+			}
+			op, ok := hostOperators.Get(v.Name())
+			if !ok {
+				reset()
+				continue
+			}
+
+			// Check the arguments that are known
+			known := min(len(stack), len(op.Args))
+			if known < len(op.Args) && !unknown {
+				return fmt.Errorf("%s: want %d arguments, got %d", op.Name, len(op.Args), len(stack))
+			}
+			for j, got := range stack[len(stack)-known:] {
+				want := op.Args[len(op.Args)-known+j]
+				if !typeMatches(want, got) {
+					return fmt.Errorf("%s: argument %d: want %v, got %v", op.Name, len(op.Args)-known+j+1, typeName(want), typeName(got))
+				}
+			}
+			stack = append(stack[:len(stack)-known], op.Results...)
+
+		case vm.LiteralName, *vm.ExecutableArray:
+			stack = append(stack, v.Type())
+
+		default:
+			// Built-in operators and compound names
+			if v.Type() == vm.NameType {
+				reset()
+				continue
+			}
+			stack = append(stack, v.Type())
+		}
+	}
+	return nil
+}
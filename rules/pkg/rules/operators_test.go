@@ -0,0 +1,109 @@
+package rules_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func init() {
+	// blocked? returns true if the certification status is on the blocklist
+	err := rules.RegisterOperator(rules.Operator{
+		Name:    "blocked?",
+		Args:    []vm.Type{vm.StringType},
+		Results: []vm.Type{vm.BooleanType},
+		Fn: func(s vm.State) error {
+			v, err := s.Data().Pop(1)
+			if err != nil {
+				return err
+			}
+			id, err := vm.AsString(v[0])
+			if err != nil {
+				return err
+			}
+			if id == "mallory" {
+				return s.Data().Push(vm.True)
+			}
+			return s.Data().Push(vm.False)
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// operatorRuleset builds a ruleset with a single table that denies the
+// certificate if the condition is true.
+func operatorRuleset(t *testing.T, condition string) (*rules.Ruleset, error) {
+	t.Helper()
+	dt := fmt.Sprintf(`<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<attribute_fields><TYPE>FIRST</TYPE></attribute_fields>
+<conditions><condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>%s</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details></conditions>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>true cvb /denied xdef "Operator is blocked" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`, condition)
+
+	return rules.LoadRuleset(context.Background(), nil, rules.DefaultRulesetName, testFiles(t, dt))
+}
+
+func TestRegisterOperator(t *testing.T) {
+	rs, err := operatorRuleset(t, "certificationStatus blocked?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+
+	for id, denied := range map[string]bool{"alice": false, "mallory": true} {
+		cert := rules.NewCertificate(map[string]any{
+			"certificationStatus": id,
+			"dataOperationType":   "create",
+			"fromDate":            "2024-01-01",
+			"toDate":              "2099-01-01",
+		})
+		res, err := engine.Evaluate(context.Background(), &rules.Request{}, cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Denied != denied {
+			t.Fatalf("%s: want denied=%v, got %v", id, denied, res.Denied)
+		}
+	}
+}
+
+func TestRegisterOperatorRejects(t *testing.T) {
+	op := rules.Operator{Name: "blocked?", Fn: func(vm.State) error { return nil }}
+	if err := rules.RegisterOperator(op); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("want duplicate error, got %v", err)
+	}
+
+	op.Name = "dup"
+	if err := rules.RegisterOperator(op); err == nil || !strings.Contains(err.Error(), "built-in") {
+		t.Fatalf("want built-in error, got %v", err)
+	}
+}
+
+func TestOperatorSignatureChecked(t *testing.T) {
+	cases := map[string]string{
+		"missing argument": "blocked?",
+		"wrong type":       "42 blocked?",
+		"wrong field type": "denied blocked?",
+	}
+	for name, condition := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := operatorRuleset(t, condition)
+			if err == nil || !strings.Contains(err.Error(), "blocked?") {
+				t.Fatalf("want a signature error, got %v", err)
+			}
+		})
+	}
+}
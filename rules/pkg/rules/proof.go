@@ -0,0 +1,172 @@
+package rules
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/database/merkle"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+// Anchor is a root of the directory network's anchor chain that is trusted
+// without asking the network, such as one read from a node the operator
+// runs, and the directory block that recorded it.
+type Anchor struct {
+	Height uint64
+	Root   [32]byte
+}
+
+// ParseAnchor parses an anchor written as height:root, with the root in hex.
+func ParseAnchor(s string) (*Anchor, error) {
+	height, root, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid anchor %q: want height:root", s)
+	}
+	h, err := strconv.ParseUint(height, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid anchor height: %w", err)
+	}
+	b, err := hex.DecodeString(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid anchor root: %w", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("invalid anchor root: want 32 bytes, got %d", len(b))
+	}
+	return &Anchor{Height: h, Root: [32]byte(b)}, nil
+}
+
+func (a *Anchor) String() string { return fmt.Sprintf("%d:%x", a.Height, a.Root) }
+
+// Proof is a receipt that proves an entry a decision is based on was recorded
+// by the network, from the hash of the entry's transaction or signature up to
+// a trusted anchor.
+type Proof struct {
+	Account *url.URL        `json:"account"`
+	Chain   string          `json:"chain"`
+	Entry   string          `json:"entry"`
+	Height  uint64          `json:"height"`
+	Receipt *merkle.Receipt `json:"receipt"`
+}
+
+// prover proves the entries fetched while executing a request.
+type prover struct {
+	anchors []*Anchor
+	mu      sync.Mutex
+	proofs  []*Proof
+}
+
+type proverKey struct{}
+
+// withProofs returns a context in which the entries that are fetched must be
+// proven, if there are any trusted anchors.
+func withProofs(ctx context.Context, anchors []*Anchor) (context.Context, *prover) {
+	if len(anchors) == 0 {
+		return ctx, nil
+	}
+	p := &prover{anchors: slices.Clone(anchors)}
+	slices.SortFunc(p.anchors, func(a, b *Anchor) int { return cmp.Compare(b.Height, a.Height) })
+	return context.WithValue(ctx, proverKey{}, p), p
+}
+
+// list returns the proofs, or nil if nothing had to be proven.
+func (p *prover) list() []*Proof {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.proofs)
+}
+
+// proveEntry proves that the transaction was recorded on the account's main
+// chain, if the context requires it. The hash of the transaction is computed
+// locally so the proof covers what the network returned.
+func proveEntry(ctx context.Context, client api.Querier, account *url.URL, txn *protocol.Transaction) error {
+	if ctx.Value(proverKey{}) == nil {
+		return nil
+	}
+	if !txn.Header.Principal.Equal(account) {
+		return fmt.Errorf("entry was written to %v, not %v", txn.Header.Principal, account)
+	}
+	return proveChainEntry(ctx, client, account, "main", txn.GetHash())
+}
+
+// proveChainEntry proves that the hash was recorded on the account's chain, if
+// the context requires it. Each anchor is tried in turn, the latest first,
+// since an entry can only be proven up to an anchor that was recorded after
+// it, and a node that returns a bad receipt for one anchor may return a good
+// one for another.
+func proveChainEntry(ctx context.Context, client api.Querier, account *url.URL, chain string, hash []byte) error {
+	p, ok := ctx.Value(proverKey{}).(*prover)
+	if !ok {
+		return nil
+	}
+
+	Q := api.Querier2{Querier: client}
+	var lastErr error
+	for _, a := range p.anchors {
+		r, err := Q.QueryChainEntry(ctx, account, &api.ChainQuery{Name: chain, Entry: hash, IncludeReceipt: &api.ReceiptOptions{ForHeight: a.Height}})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if r.Receipt == nil {
+			lastErr = fmt.Errorf("the network did not return a receipt for height %d", a.Height)
+			continue
+		}
+		receipt := &r.Receipt.Receipt
+		switch {
+		case !bytes.Equal(receipt.Start, hash):
+			lastErr = fmt.Errorf("the receipt starts at %x", receipt.Start)
+			continue
+		case !bytes.Equal(receipt.Anchor, a.Root[:]):
+			lastErr = fmt.Errorf("the receipt ends at %x, not the trusted anchor %v", receipt.Anchor, a)
+			continue
+		case !receipt.Validate(nil):
+			lastErr = fmt.Errorf("the receipt for height %d is invalid", a.Height)
+			continue
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.proofs = append(p.proofs, &Proof{Account: account, Chain: chain, Entry: hex.EncodeToString(hash), Height: a.Height, Receipt: receipt.Copy()})
+		return nil
+	}
+	return fmt.Errorf("%v: %s chain entry %x cannot be proven up to a trusted anchor: %w", account, chain, hash, lastErr)
+}
+
+// proveTransaction proves that the transaction with the hash was recorded on
+// the main chain of its principal, if the context requires it.
+func proveTransaction(ctx context.Context, client api.Querier, id [32]byte, txn *protocol.Transaction) error {
+	if ctx.Value(proverKey{}) == nil {
+		return nil
+	}
+	if got := txn.GetHash(); !bytes.Equal(got, id[:]) {
+		return fmt.Errorf("transaction hash mismatch: want %x, got %x", id, got)
+	}
+	return proveEntry(ctx, client, txn.Header.Principal, txn)
+}
+
+// SetAnchors replaces the trusted anchors. If any are set, the personal bank,
+// certificate, and published ruleset entries and the issuers' signatures used
+// by [Engine.Execute] must be proven up to one of them, and the proofs are
+// returned with the result.
+func (e *Engine) SetAnchors(anchors []*Anchor) { e.anchors.Store(&anchors) }
+
+// Anchors returns the trusted anchors.
+func (e *Engine) Anchors() []*Anchor {
+	if a := e.anchors.Load(); a != nil {
+		return *a
+	}
+	return nil
+}
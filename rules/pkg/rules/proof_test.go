@@ -0,0 +1,123 @@
+package rules_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+func TestProofs(t *testing.T) {
+	q := newHistoryQuerier()
+	identity := url.MustParse("alice.acme")
+	cert := q.writeCertificate(identity, 10, map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	})
+	q.write(url.MustParse("bob.acme/data"), 12, []byte("unrelated"))
+
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	execute := func(anchors ...*rules.Anchor) (*rules.Result, error) {
+		engine.SetAnchors(anchors)
+		return engine.Execute(context.Background(), q, &rules.Request{Identity: identity})
+	}
+
+	// Without anchors nothing is proven
+	res, err := execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Proofs != nil {
+		t.Fatalf("want no proofs, got %+v", res.Proofs)
+	}
+
+	// The personal bank and certificate entries are proven up to the anchor
+	anchor := &rules.Anchor{Height: 15, Root: q.anchor(15)}
+	res, err = execute(anchor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Denied || len(res.Proofs) != 2 {
+		t.Fatalf("want an allowed result with 2 proofs, got %+v", res)
+	}
+	if p := res.Proofs[1]; p.Account.String() != "acc://aml.acme/certificates" || p.Entry != fmt.Sprintf("%x", cert) || p.Height != 15 {
+		t.Fatalf("want the proof of the certificate, got %+v", p)
+	}
+	for _, p := range res.Proofs {
+		if !p.Receipt.Validate(nil) || string(p.Receipt.Anchor) != string(anchor.Root[:]) {
+			t.Fatalf("want a valid receipt up to the anchor, got %+v", p.Receipt)
+		}
+	}
+
+	// An entry recorded after the anchor cannot be proven until a later
+	// anchor is trusted
+	q.writeCertificate(identity, 20, map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2031-01-01",
+	})
+	_, err = execute(anchor)
+	if err == nil || !strings.Contains(err.Error(), "cannot be proven") {
+		t.Fatalf("want an unproven entry, got %v", err)
+	}
+	res, err = execute(anchor, &rules.Anchor{Height: 25, Root: q.anchor(25)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Proofs[0].Height != 25 {
+		t.Fatalf("want proofs up to the later anchor, got %d", res.Proofs[0].Height)
+	}
+
+	// A receipt that ends anywhere else is rejected, and the next anchor is
+	// tried
+	_, err = execute(&rules.Anchor{Height: 25, Root: [32]byte{1}})
+	if err == nil || !strings.Contains(err.Error(), "not the trusted anchor") {
+		t.Fatalf("want an untrusted anchor, got %v", err)
+	}
+	res, err = execute(&rules.Anchor{Height: 30, Root: [32]byte{1}}, &rules.Anchor{Height: 25, Root: q.anchor(25)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Proofs[0].Height != 25 {
+		t.Fatalf("want proofs up to the trusted anchor, got %d", res.Proofs[0].Height)
+	}
+
+	// A published ruleset is proven with every request
+	policy := url.MustParse("aml.acme/policy")
+	hash := q.write(policy, 22, must1(os.ReadFile("compiled_edd.xml")), must1(os.ReadFile("compiled_dt.xml")))
+	rs := must1(rules.FetchRuleset(context.Background(), q, rules.DefaultRulesetName, rules.DefaultEntryPoint, policy, hash))
+	engine = rules.NewEngine(must1(rules.NewRegistry(rs)))
+	res, err = execute(&rules.Anchor{Height: 25, Root: q.anchor(25)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Proofs) != 3 || !res.Proofs[0].Account.Equal(policy) || res.Proofs[0].Chain != "main" {
+		t.Fatalf("want the ruleset proven first, got %+v", res.Proofs)
+	}
+	_, err = execute(anchor)
+	if err == nil || !strings.Contains(err.Error(), "prove ruleset") {
+		t.Fatalf("want an unproven ruleset, got %v", err)
+	}
+}
+
+func TestParseAnchor(t *testing.T) {
+	a, err := rules.ParseAnchor("42:" + strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Height != 42 || a.Root[31] != 0xab || a.String() != "42:"+strings.Repeat("ab", 32) {
+		t.Fatalf("got %v", a)
+	}
+	for _, s := range []string{"42", "x:" + strings.Repeat("ab", 32), "42:abcd", "42:zz"} {
+		if _, err := rules.ParseAnchor(s); err == nil {
+			t.Fatalf("want an error for %q", s)
+		}
+	}
+}
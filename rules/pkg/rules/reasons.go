@@ -0,0 +1,291 @@
+package rules
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"gopkg.in/yaml.v3"
+)
+
+// Reason is a machine-readable denial reason. Code is stable and can be
+// branched on; Message is rendered for the locale of the request.
+type Reason struct {
+	Code    string         `json:"code"`
+	Params  map[string]any `json:"params,omitempty"`
+	Message string         `json:"message"`
+}
+
+// ReasonUnspecified is the code of a denial reason that is not a registered
+// code or the text of one.
+const ReasonUnspecified = "UNSPECIFIED"
+
+// ReasonCode defines a denial reason. Decision tables add either the code or,
+// for tables written before reason codes, the text to denialReason.
+type ReasonCode struct {
+	Code string
+
+	// Text is the English text of the reason, as written by decision tables.
+	Text string
+
+	// Params are the names of certificate fields that are included as
+	// parameters of the reason and can be used by the messages.
+	Params []string
+}
+
+// RegisterReasonCode registers a denial reason. Codes are case sensitive.
+func RegisterReasonCode(rc ReasonCode) error {
+	return reasonCodes.register(rc)
+}
+
+type reasonRegistry struct {
+	mu     sync.RWMutex
+	codes  map[string]*ReasonCode
+	byText map[string]*ReasonCode
+}
+
+var reasonCodes = newReasonRegistry(
+	ReasonCode{Code: "CERT_REVOKED", Text: "Certificate has been revoked"},
+	ReasonCode{Code: "CERT_FAILED", Text: "Certification failed", Params: []string{"certificationStatus"}},
+	ReasonCode{Code: "CERT_NOT_YET_ACTIVE", Text: "Certificate is not yet active", Params: []string{"fromDate"}},
+	ReasonCode{Code: "CERT_EXPIRED", Text: "Certificate has expired", Params: []string{"toDate"}},
+	ReasonCode{Code: "CERT_FIELD_MISSING"},
+	ReasonCode{Code: "CERT_FIELD_WRONG_TYPE"},
+	ReasonCode{Code: "STRUCTURING_SUSPECTED", Text: "Several transfers just below the reporting threshold"},
+	ReasonCode{Code: "ROUND_TRIP_SUSPECTED", Text: "Funds were sent back and forth between the same parties"},
+	ReasonCode{Code: "ISSUER_UNTRUSTED", Text: "Certificate was not signed by a trusted issuer"},
+	ReasonCode{Code: "RISK_PROHIBITED", Text: "Risk tier is prohibited"},
+	ReasonCode{Code: "SANCTIONS_MATCH", Text: "Name matches a sanctions list entry"},
+	ReasonCode{Code: "EVM_CHECKSUM_INVALID", Text: "Recipient address has an invalid checksum"},
+	ReasonCode{Code: "EVM_ADDRESS_DENYLISTED", Text: "Recipient address is on a denylist"},
+	ReasonCode{Code: "EVM_ADDRESS_SANCTIONED", Text: "Recipient address is sanctioned"},
+)
+
+func newReasonRegistry(codes ...ReasonCode) *reasonRegistry {
+	r := &reasonRegistry{codes: map[string]*ReasonCode{}, byText: map[string]*ReasonCode{}}
+	for _, rc := range codes {
+		must(r.register(rc))
+	}
+	return r
+}
+
+func (r *reasonRegistry) register(rc ReasonCode) error {
+	if rc.Code == "" || rc.Code == ReasonUnspecified {
+		return fmt.Errorf("invalid reason code %q", rc.Code)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.codes[rc.Code]; ok {
+		return fmt.Errorf("reason code %s is already registered", rc.Code)
+	}
+	text := strings.ToLower(rc.Text)
+	if other, ok := r.byText[text]; ok && text != "" {
+		return fmt.Errorf("reason code %s has the same text as %s", rc.Code, other.Code)
+	}
+	r.codes[rc.Code] = &rc
+	if text != "" {
+		r.byText[text] = &rc
+	}
+	return nil
+}
+
+// lookup returns the reason code of a denial reason, which is either a code or
+// the text of one.
+func (r *reasonRegistry) lookup(reason string) (*ReasonCode, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if rc, ok := r.codes[reason]; ok {
+		return rc, true
+	}
+	rc, ok := r.byText[strings.ToLower(strings.TrimSpace(reason))]
+	return rc, ok
+}
+
+// Catalog holds the message templates of denial reasons, indexed by locale and
+// then code. A template refers to a parameter as {name}.
+type Catalog map[string]map[string]string
+
+//go:embed locales/*.yaml
+var localeFiles embed.FS
+
+var defaultCatalog = must1(LoadCatalog(must1(fs.Sub(localeFiles, "locales"))))
+
+// DefaultLocale is used when none of the requested locales are available.
+const DefaultLocale = "en"
+
+// DefaultCatalog returns the catalog that is compiled into the binary.
+func DefaultCatalog() Catalog { return defaultCatalog }
+
+// LoadCatalog reads a catalog from a file system. Each file is named for its
+// locale, such as de.yaml or pt-br.json, and maps codes to templates.
+func LoadCatalog(fsys fs.FS) (Catalog, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	c := Catalog{}
+	for _, e := range entries {
+		ext := path.Ext(e.Name())
+		switch ext {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		err = yaml.Unmarshal(b, &messages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		c[normalizeLocale(strings.TrimSuffix(e.Name(), ext))] = messages
+	}
+	if len(c) == 0 {
+		return nil, errors.New("no message catalogs found")
+	}
+	return c, nil
+}
+
+// Merge returns a catalog with the messages of both catalogs. Messages of d
+// take precedence.
+func (c Catalog) Merge(d Catalog) Catalog {
+	out := Catalog{}
+	for _, x := range []Catalog{c, d} {
+		for locale, messages := range x {
+			if out[locale] == nil {
+				out[locale] = map[string]string{}
+			}
+			for code, msg := range messages {
+				out[locale][code] = msg
+			}
+		}
+	}
+	return out
+}
+
+// Negotiate returns the best available locale for a list of locales in the
+// format of an Accept-Language header, such as "de-CH, de;q=0.9, en;q=0.5". A
+// regional locale falls back to its language. If nothing matches, Negotiate
+// returns [DefaultLocale].
+func (c Catalog) Negotiate(accept string) string {
+	type choice struct {
+		locale string
+		q      float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(accept, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		tag = normalizeLocale(tag)
+		if tag != "" && tag != "*" && q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, ch := range choices {
+		if _, ok := c[ch.locale]; ok {
+			return ch.locale
+		}
+		lang, _, _ := strings.Cut(ch.locale, "-")
+		if _, ok := c[lang]; ok {
+			return lang
+		}
+	}
+	return DefaultLocale
+}
+
+// Render renders the message of a code, falling back to [DefaultLocale].
+func (c Catalog) Render(locale, code string, params map[string]any) (string, bool) {
+	msg, ok := c[locale][code]
+	if !ok {
+		msg, ok = c[DefaultLocale][code]
+	}
+	if !ok {
+		return "", false
+	}
+	var oldnew []string
+	for k, v := range params {
+		oldnew = append(oldnew, "{"+k+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(oldnew...).Replace(msg), true
+}
+
+func normalizeLocale(s string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "_", "-"))
+}
+
+// SetCatalog replaces the message catalog. If it is never set, the engine
+// uses [DefaultCatalog].
+func (e *Engine) SetCatalog(c Catalog) { e.catalog.Store(&c) }
+
+// Catalog returns the message catalog.
+func (e *Engine) Catalog() Catalog {
+	if c := e.catalog.Load(); c != nil {
+		return *c
+	}
+	return defaultCatalog
+}
+
+// reasons converts the denial reasons written by the decision tables to
+// reason codes. Parameters are read from the certificate.
+func (e *Engine) reasons(s vm.State, locale string, cert vm.Entity, denialReason any) []*Reason {
+	var reasons []*Reason
+	for _, text := range denialReasons(denialReason) {
+		rc, ok := reasonCodes.lookup(text)
+		if !ok {
+			reasons = append(reasons, &Reason{Code: ReasonUnspecified, Message: text})
+			continue
+		}
+
+		r := &Reason{Code: rc.Code}
+		for _, name := range rc.Params {
+			f, ok := cert.Field(vm.LiteralName(name))
+			if !ok {
+				continue
+			}
+			v, err := f.Load(s)
+			if err != nil {
+				continue
+			}
+			u, err := vm.AsAny(v)
+			if err != nil {
+				continue
+			}
+			if r.Params == nil {
+				r.Params = map[string]any{}
+			}
+			r.Params[name] = u
+		}
+		reasons = append(reasons, e.render(locale, r, text))
+	}
+	return reasons
+}
+
+// render sets the message of the reason. If the catalog does not have a
+// message for the code, the fallback is used.
+func (e *Engine) render(locale string, r *Reason, fallback string) *Reason {
+	var ok bool
+	r.Message, ok = e.Catalog().Render(locale, r.Code, r.Params)
+	if !ok {
+		r.Message = fallback
+	}
+	return r
+}
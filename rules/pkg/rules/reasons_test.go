@@ -0,0 +1,88 @@
+package rules_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestNegotiateLocale(t *testing.T) {
+	cases := map[string]string{
+		"":                          "en",
+		"de":                        "de",
+		"de-CH, fr;q=0.9":           "de",
+		"ja, pt-BR;q=0.8, en;q=0.5": "pt",
+		"fr;q=0.5, es;q=0.9":        "es",
+		"es_MX":                     "es",
+		"*, ja":                     "en",
+		"de;q=0, fr":                "fr",
+	}
+	for accept, want := range cases {
+		if got := rules.DefaultCatalog().Negotiate(accept); got != want {
+			t.Errorf("%q: want %s, got %s", accept, want, got)
+		}
+	}
+}
+
+func TestReasonCodes(t *testing.T) {
+	asOf := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	engine := rules.NewEngine(rules.DefaultRegistry())
+	res := engine.RunFixture(context.Background(), &rules.Fixture{
+		AsOf: &asOf,
+		Certificate: map[string]any{
+			"certificationStatus": "passed",
+			"dataOperationType":   "create",
+			"fromDate":            "2024-01-01",
+			"toDate":              "2025-01-01",
+		},
+		Expect: rules.Expectation{Denied: true},
+	}).Result
+
+	// The legacy text is kept and the reason is rendered in English
+	if reasons := res.DenialReason.([]any); len(reasons) != 1 || reasons[0] != "Certificate has expired" {
+		t.Fatalf("want the legacy denial reason, got %v", res.DenialReason)
+	}
+	if len(res.Reasons) != 1 || res.Reasons[0].Code != "CERT_EXPIRED" {
+		t.Fatalf("want CERT_EXPIRED, got %+v", res.Reasons)
+	}
+	if got := res.Reasons[0]; got.Params["toDate"] != "2025-01-01" || got.Message != "Certificate has expired (valid until 2025-01-01)" {
+		t.Fatalf("want the expiry date as a parameter, got %+v", got)
+	}
+
+	// A catalog can override and add locales
+	engine.SetCatalog(rules.DefaultCatalog().Merge(must1(rules.LoadCatalog(fstest.MapFS{
+		"nl.yaml": {Data: []byte("CERT_EXPIRED: Het certificaat is verlopen op {toDate}\n")},
+	}))))
+	cert := rules.NewCertificate(map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2025-01-01",
+	})
+	ctx := context.Background()
+	res, err := engine.Evaluate(ctx, &rules.Request{Locale: "nl-BE, de;q=0.5"}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Locale != "nl" || len(res.Reasons) != 1 || res.Reasons[0].Message != "Het certificaat is verlopen op 2025-01-01" {
+		t.Fatalf("want a Dutch message, got %s %+v", res.Locale, res.Reasons)
+	}
+}
+
+func TestReasonCodeSchemaViolation(t *testing.T) {
+	cert := rules.NewCertificate(map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+	})
+	res, err := rules.NewEngine(rules.DefaultRegistry()).Evaluate(context.Background(), &rules.Request{Locale: "de"}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Reasons) != 1 || res.Reasons[0].Code != "CERT_FIELD_MISSING" || res.Reasons[0].Message != "Das Zertifikatsfeld toDate fehlt" {
+		t.Fatalf("want a German CERT_FIELD_MISSING, got %+v", res.Reasons)
+	}
+}
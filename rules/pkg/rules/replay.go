@@ -0,0 +1,272 @@
+package rules
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	errors2 "gitlab.com/accumulatenetwork/accumulate/pkg/errors"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/types/messaging"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+// Moment is a point in the history of the network, given as a time or as the
+// height of the local block of the partition an account is on. If both are
+// set, an entry must satisfy both.
+type Moment struct {
+	Time   *time.Time `json:"time,omitempty"`
+	Height *uint64    `json:"height,omitempty"`
+}
+
+func (m *Moment) String() string {
+	switch {
+	case m.Time != nil && m.Height != nil:
+		return fmt.Sprintf("%v and block %d", m.Time.Format(time.RFC3339), *m.Height)
+	case m.Time != nil:
+		return m.Time.Format(time.RFC3339)
+	case m.Height != nil:
+		return fmt.Sprintf("block %d", *m.Height)
+	}
+	return "now"
+}
+
+// ReplayRecord identifies the on-chain state a replayed result is based on.
+type ReplayRecord struct {
+	Moment
+	PersonalBank *EntryRef `json:"personalBank"`
+
+	// Certificate is the ID of the primary certificate.
+	Certificate string `json:"certificate"`
+
+	// Ruleset is the entry the ruleset was read from, if the ruleset is
+	// published to a data account.
+	Ruleset *EntryRef `json:"ruleset,omitempty"`
+}
+
+// EntryRef identifies a data entry and the block it was recorded in.
+type EntryRef struct {
+	ID    *url.TxID  `json:"id"`
+	Block uint64     `json:"block"`
+	Time  *time.Time `json:"time,omitempty"`
+}
+
+// historicalEntry is a data entry that was in force at a moment.
+type historicalEntry struct {
+	txn *protocol.Transaction
+	ref *EntryRef
+}
+
+// replayPageSize is the number of chain entries requested at once while
+// walking back through an account's history.
+const replayPageSize = 50
+
+// replay evaluates the certificates the identity referred to at a moment, with
+// the version of the ruleset that was in force at that moment. The
+// certificate is evaluated as of the moment's time or, if only a height is
+// given, as of the time of the block that recorded the personal bank entry.
+func (e *Engine) replay(ctx context.Context, client api.Querier, rs *Ruleset, req *Request) (*Result, error) {
+	m := req.Replay
+	if m.Time == nil && m.Height == nil {
+		return nil, errors.New("replay: a time or a block height is required")
+	}
+
+	bank, err := fetchDataEntryAt(ctx, client, personalBankUrl(req.Identity), m)
+	if err == nil {
+		err = proveEntry(ctx, client, personalBankUrl(req.Identity), bank.txn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetch personal bank metadata as of %v: %w", m, err)
+	}
+	personalBank, err := decodeDataEntry[any](bank.txn)
+	if err != nil {
+		return nil, fmt.Errorf("fetch personal bank metadata as of %v: %w", m, err)
+	}
+	refs, err := certRefsFromPersonalBank(personalBank)
+	if err != nil {
+		return nil, err
+	}
+
+	// A certificate is a transaction, so it cannot change once it has been
+	// recorded
+	certs, err := fetchAmlCerts(ctx, client, refs)
+	if err != nil {
+		return nil, err
+	}
+	err = fetchIssuers(ctx, client, rs, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &ReplayRecord{Moment: *m, PersonalBank: bank.ref, Certificate: hex.EncodeToString(refs[0].ID[:])}
+	if rs.Account != nil {
+		entry, err := fetchDataEntryAt(ctx, client, rs.Account, m)
+		if err == nil {
+			err = proveEntry(ctx, client, rs.Account, entry.txn)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetch ruleset as of %v: %w", m, err)
+		}
+		rs, err = rulesetAt(rs, entry)
+		if err != nil {
+			return nil, err
+		}
+		record.Ruleset = entry.ref
+	}
+
+	r := *req
+	switch {
+	case r.AsOf != nil:
+	case m.Time != nil:
+		r.AsOf = m.Time
+	case bank.ref.Time != nil:
+		r.AsOf = bank.ref.Time
+	default:
+		return nil, fmt.Errorf("replay: the time of block %d is unknown, specify asOf", bank.ref.Block)
+	}
+
+	history, err := e.history(ctx, client, rs, &r, req.Identity)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.evaluateCertificates(ctx, rs, &r, certs, history...)
+	if err != nil {
+		return nil, err
+	}
+	res.Replay = record
+	return res, nil
+}
+
+// rulesetAt returns the version of a published ruleset that was written by
+// the entry.
+func rulesetAt(rs *Ruleset, entry *historicalEntry) (*Ruleset, error) {
+	data, err := getDataEntry(entry.txn)
+	if err != nil {
+		return nil, err
+	}
+	hash := [32]byte(data.Hash())
+	if hash == rs.Hash {
+		return rs, nil
+	}
+
+	old, err := rulesetFromTransaction(rs.Name, rs.Entry, rs.Account, entry.txn, hash)
+	if err != nil {
+		return nil, err
+	}
+	old.RiskThresholds = rs.RiskThresholds
+	old.Aggregation = rs.Aggregation
+	old.TrustedIssuers = rs.TrustedIssuers
+	return old, nil
+}
+
+// fetchDataEntryAt returns the latest data entry that was written to the
+// account at or before the moment.
+func fetchDataEntryAt(ctx context.Context, client api.Querier, account *url.URL, m *Moment) (*historicalEntry, error) {
+	var found *historicalEntry
+	err := walkDataEntries(ctx, client, account, m.Time != nil, func(entry *historicalEntry) bool {
+		if m.Height != nil && entry.ref.Block > *m.Height {
+			return true
+		}
+		if m.Time != nil && entry.ref.Time.After(*m.Time) {
+			return true
+		}
+		found = entry
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%v has no data entry as of %v", account, m)
+	}
+	return found, nil
+}
+
+// walkDataEntries calls the function for each delivered data entry of the
+// account, walking the account's main chain back from the most recent entry,
+// until the function returns false. If withTime is true, the time of each
+// entry is always known.
+func walkDataEntries(ctx context.Context, client api.Querier, account *url.URL, withTime bool, fn func(*historicalEntry) bool) error {
+	Q := api.Querier2{Querier: client}
+	return walkMainChain(ctx, client, account, func(rec *mainChainEntry) (bool, error) {
+		entry, err := dataEntry(ctx, Q, account, rec, withTime)
+		if err != nil {
+			return false, err
+		}
+		return entry == nil || fn(entry), nil
+	})
+}
+
+type mainChainEntry = api.ChainEntryRecord[*api.MessageRecord[*messaging.TransactionMessage]]
+
+// walkMainChain calls the function for each entry of the account's main
+// chain, back from the most recent entry, until the function returns false or
+// an error.
+func walkMainChain(ctx context.Context, client api.Querier, account *url.URL, fn func(*mainChainEntry) (bool, error)) error {
+	Q := api.Querier2{Querier: client}
+	expand := true
+	count := uint64(replayPageSize)
+	query := &api.ChainQuery{
+		Name:           "main",
+		Range:          &api.RangeOptions{Count: &count, Expand: &expand, FromEnd: true},
+		IncludeReceipt: &api.ReceiptOptions{ForAny: true},
+	}
+	for {
+		r, err := Q.QueryMainChainEntries(ctx, account, query)
+		if err != nil {
+			return err
+		}
+
+		for i := len(r.Records) - 1; i >= 0; i-- {
+			ok, err := fn(r.Records[i])
+			if !ok || err != nil {
+				return err
+			}
+		}
+
+		if r.Start == 0 || len(r.Records) == 0 {
+			return nil
+		}
+		n := min(count, r.Start)
+		query.Range = &api.RangeOptions{Start: r.Start - n, Count: &n, Expand: &expand}
+	}
+}
+
+// dataEntry returns the chain entry if it is a delivered data entry, or nil.
+func dataEntry(ctx context.Context, Q api.Querier2, account *url.URL, rec *mainChainEntry, withTime bool) (*historicalEntry, error) {
+	msg := rec.Value
+	if msg == nil || msg.Message == nil || msg.Status != errors2.Delivered {
+		return nil, nil
+	}
+	switch msg.Message.Transaction.Body.(type) {
+	case *protocol.WriteData, *protocol.SyntheticWriteData:
+	default:
+		return nil, nil
+	}
+
+	// Receipts are not always included in a range, so fetch the entry by
+	// itself if the time is needed
+	receipt := rec.Receipt
+	if receipt == nil && withTime {
+		index := rec.Index
+		r, err := Q.QueryMainChainEntry(ctx, account, &api.ChainQuery{Name: "main", Index: &index, IncludeReceipt: &api.ReceiptOptions{ForAny: true}})
+		if err != nil {
+			return nil, err
+		}
+		if r.Receipt == nil {
+			return nil, fmt.Errorf("%v: the network did not return a receipt for main chain entry %d", account, index)
+		}
+		receipt = r.Receipt
+	}
+
+	ref := &EntryRef{ID: msg.ID, Block: msg.Received}
+	if receipt != nil {
+		ref.Block = receipt.LocalBlock
+		t := receipt.LocalBlockTime
+		ref.Time = &t
+	}
+	return &historicalEntry{txn: msg.Message.Transaction, ref: ref}, nil
+}
@@ -0,0 +1,418 @@
+package rules_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/errors"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/types/merkle"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/types/messaging"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+// historyQuerier records data entries written to accounts in blocks and
+// answers main chain, data entry (the latest or by hash), transaction, key
+// page, and signature chain queries. Main chain entries can be proven up to an
+// anchor of every entry recorded at or before a height.
+type historyQuerier struct {
+	chains     map[string][]*historyEntry
+	txns       map[[32]byte]*protocol.Transaction
+	signatures map[[32]byte][]*signatureEntry
+	pages      map[string]*protocol.KeyPage
+}
+
+type signatureEntry struct {
+	msg   *messaging.SignatureMessage
+	block uint64
+}
+
+type historyEntry struct {
+	txn   *protocol.Transaction
+	block uint64
+	time  time.Time
+}
+
+func newHistoryQuerier() *historyQuerier {
+	return &historyQuerier{chains: map[string][]*historyEntry{}, txns: map[[32]byte]*protocol.Transaction{}, signatures: map[[32]byte][]*signatureEntry{}, pages: map[string]*protocol.KeyPage{}}
+}
+
+// testKey returns the public key of a named test key, and testKeyHash its
+// hash.
+func testKey(name string) []byte {
+	h := sha256.Sum256([]byte(name))
+	return h[:]
+}
+
+func testKeyHash(name string) []byte {
+	h := sha256.Sum256(testKey(name))
+	return h[:]
+}
+
+// keyPage records the current version and keys of a key page.
+func (q *historyQuerier) keyPage(page *url.URL, version uint64, keys ...string) {
+	p := &protocol.KeyPage{Url: page, Version: version}
+	for _, k := range keys {
+		p.Keys = append(p.Keys, &protocol.KeySpec{PublicKeyHash: testKeyHash(k)})
+	}
+	q.pages[page.String()] = p
+}
+
+// update records a transaction that updates a key page and returns its hash.
+func (q *historyQuerier) update(page *url.URL, block uint64, body protocol.TransactionBody) [32]byte {
+	txn := new(protocol.Transaction)
+	txn.Header.Principal = page
+	txn.Body = body
+	q.txns[[32]byte(txn.GetHash())] = txn
+	q.chains[page.String()] = append(q.chains[page.String()], &historyEntry{txn, block, blockTime(block)})
+	return [32]byte(txn.GetHash())
+}
+
+// sign records a signature of the transaction by the key page in a block,
+// with the key named for the page at version 1.
+func (q *historyQuerier) sign(txn [32]byte, signer *url.URL, block uint64) {
+	q.signWith(txn, signer, signer.String(), 1, block)
+}
+
+// signWith records a signature of the transaction by the named key of the key
+// page at the version in a block.
+func (q *historyQuerier) signWith(txn [32]byte, signer *url.URL, key string, version, block uint64) {
+	sig := &protocol.ED25519Signature{Signer: signer, SignerVersion: version, PublicKey: testKey(key), Signature: make([]byte, 64), TransactionHash: txn}
+	msg := &messaging.SignatureMessage{Signature: sig, TxID: signer.WithTxID(txn)}
+	q.signatures[txn] = append(q.signatures[txn], &signatureEntry{msg, block})
+}
+
+func (q *historyQuerier) signatureRecord(e *signatureEntry) *api.MessageRecord[messaging.Message] {
+	return &api.MessageRecord[messaging.Message]{
+		ID:      e.msg.Signature.GetSigner().WithTxID(e.msg.Hash()),
+		Message: e.msg,
+		Status:  errors.Delivered,
+	}
+}
+
+// write records a data entry and returns its hash.
+func (q *historyQuerier) write(account *url.URL, block uint64, data ...[]byte) [32]byte {
+	entry := &protocol.DoubleHashDataEntry{Data: data}
+	txn := new(protocol.Transaction)
+	txn.Header.Principal = account
+	txn.Body = &protocol.WriteData{Entry: entry}
+	q.txns[[32]byte(txn.GetHash())] = txn
+	q.chains[account.String()] = append(q.chains[account.String()], &historyEntry{txn, block, blockTime(block)})
+	return [32]byte(entry.Hash())
+}
+
+func blockTime(block uint64) time.Time {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(block) * time.Hour)
+}
+
+func (q *historyQuerier) record(account *url.URL, index int, e *historyEntry) *api.ChainEntryRecord[api.Record] {
+	return &api.ChainEntryRecord[api.Record]{
+		Account: account,
+		Name:    "main",
+		Type:    merkle.ChainTypeTransaction,
+		Index:   uint64(index),
+		Entry:   [32]byte(e.txn.GetHash()),
+		Value: &api.MessageRecord[messaging.Message]{
+			ID:       e.txn.ID(),
+			Message:  &messaging.TransactionMessage{Transaction: e.txn},
+			Status:   errors.Delivered,
+			Received: e.block,
+		},
+		Receipt: &api.Receipt{LocalBlock: e.block, LocalBlockTime: e.time},
+	}
+}
+
+// anchorLeaves returns the hash of every main and signature chain entry
+// recorded at or before the height, in the order the mock anchors them.
+func (q *historyQuerier) anchorLeaves(height uint64) [][]byte {
+	var accounts []string
+	for account := range q.chains {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	var signed [][32]byte
+	for txn := range q.signatures {
+		signed = append(signed, txn)
+	}
+	slices.SortFunc(signed, func(a, b [32]byte) int { return bytes.Compare(a[:], b[:]) })
+
+	var leaves [][]byte
+	for block := uint64(0); block <= height; block++ {
+		for _, account := range accounts {
+			for _, e := range q.chains[account] {
+				if e.block == block {
+					leaves = append(leaves, e.txn.GetHash())
+				}
+			}
+		}
+		for _, txn := range signed {
+			for _, e := range q.signatures[txn] {
+				if e.block == block {
+					h := e.msg.Hash()
+					leaves = append(leaves, h[:])
+				}
+			}
+		}
+	}
+	return leaves
+}
+
+// anchor returns the root the mock anchors the entries recorded at or before
+// the height in.
+func (q *historyQuerier) anchor(height uint64) [32]byte {
+	r, ok := q.receipt(nil, height)
+	if !ok {
+		panic("nothing was recorded")
+	}
+	return [32]byte(r.Anchor)
+}
+
+// receipt builds the receipt of an entry up to the anchor of the height. If
+// the hash is nil, the receipt of the first entry is built.
+func (q *historyQuerier) receipt(hash []byte, height uint64) (*merkle.Receipt, bool) {
+	level := q.anchorLeaves(height)
+	index := slices.IndexFunc(level, func(h []byte) bool { return hash == nil || bytes.Equal(h, hash) })
+	if index < 0 {
+		return nil, false
+	}
+	r := &merkle.Receipt{Start: level[index], StartIndex: int64(index)}
+	for len(level) > 1 {
+		switch {
+		case index%2 == 1:
+			r.Entries = append(r.Entries, &merkle.ReceiptEntry{Hash: level[index-1]})
+		case index+1 < len(level):
+			r.Entries = append(r.Entries, &merkle.ReceiptEntry{Right: true, Hash: level[index+1]})
+		}
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.Sum256(append(slices.Clone(level[i]), level[i+1]...))
+			next = append(next, h[:])
+		}
+		level, index = next, index/2
+	}
+	r.Anchor = level[0]
+	return r, true
+}
+
+func (q *historyQuerier) Query(_ context.Context, scope *url.URL, query api.Query) (api.Record, error) {
+	chain := q.chains[scope.String()]
+	switch query := query.(type) {
+	case *api.ChainQuery:
+		if query.Name == "signature" {
+			for _, sigs := range q.signatures {
+				for _, e := range sigs {
+					if e.msg.Hash() != [32]byte(query.Entry) || !e.msg.Signature.GetSigner().Equal(scope) {
+						continue
+					}
+					r := &api.ChainEntryRecord[api.Record]{
+						Account: scope,
+						Name:    "signature",
+						Type:    merkle.ChainTypeTransaction,
+						Entry:   e.msg.Hash(),
+						Value:   q.signatureRecord(e),
+						Receipt: &api.Receipt{LocalBlock: e.block, LocalBlockTime: blockTime(e.block)},
+					}
+					if query.IncludeReceipt != nil && !query.IncludeReceipt.ForAny {
+						receipt, ok := q.receipt(query.Entry, query.IncludeReceipt.ForHeight)
+						if !ok {
+							return nil, errors.NotFound.WithFormat("signature %x is not anchored at %d", query.Entry, query.IncludeReceipt.ForHeight)
+						}
+						r.Receipt.Receipt = *receipt
+					}
+					return r, nil
+				}
+			}
+			break
+		}
+		if query.Index != nil {
+			return q.record(scope, int(*query.Index), chain[*query.Index]), nil
+		}
+		if query.Entry != nil {
+			for i, e := range chain {
+				if string(e.txn.GetHash()) != string(query.Entry) {
+					continue
+				}
+				r := q.record(scope, i, e)
+				if query.IncludeReceipt != nil {
+					receipt, ok := q.receipt(e.txn.GetHash(), query.IncludeReceipt.ForHeight)
+					if !ok {
+						return nil, errors.NotFound.WithFormat("entry %x is not anchored at %d", query.Entry, query.IncludeReceipt.ForHeight)
+					}
+					r.Receipt.Receipt = *receipt
+				}
+				return r, nil
+			}
+			break
+		}
+		count := uint64(len(chain))
+		if query.Range.Count != nil {
+			count = min(count, *query.Range.Count)
+		}
+		start := query.Range.Start
+		if query.Range.FromEnd {
+			start = uint64(len(chain)) - count
+		}
+		r := &api.RecordRange[api.Record]{Start: start, Total: uint64(len(chain))}
+		for i := start; i < start+count && i < uint64(len(chain)); i++ {
+			r.Records = append(r.Records, q.record(scope, int(i), chain[i]))
+		}
+		return r, nil
+
+	case *api.DataQuery:
+		if query.Entry == nil && len(chain) > 0 {
+			return q.record(scope, len(chain)-1, chain[len(chain)-1]), nil
+		}
+		for i, e := range chain {
+			data := e.txn.Body.(*protocol.WriteData).Entry
+			if string(data.Hash()) == string(query.Entry) {
+				return q.record(scope, i, e), nil
+			}
+		}
+
+	case *api.DefaultQuery:
+		if page, ok := q.pages[scope.String()]; ok {
+			return &api.AccountRecord{Account: page}, nil
+		}
+		txid, err := scope.AsTxID()
+		if err != nil {
+			return nil, errors.NotFound.WithFormat("%v not found", scope)
+		}
+		if txn, ok := q.txns[txid.Hash()]; ok {
+			sets := &api.RecordRange[*api.SignatureSetRecord]{}
+			for _, e := range q.signatures[txid.Hash()] {
+				sets.Records = append(sets.Records, &api.SignatureSetRecord{
+					Account:    &protocol.KeyPage{Url: e.msg.Signature.GetSigner()},
+					Signatures: &api.RecordRange[*api.MessageRecord[messaging.Message]]{Records: []*api.MessageRecord[messaging.Message]{q.signatureRecord(e)}, Total: 1},
+				})
+			}
+			sets.Total = uint64(len(sets.Records))
+			return &api.MessageRecord[messaging.Message]{
+				ID:         txn.ID(),
+				Message:    &messaging.TransactionMessage{Transaction: txn},
+				Status:     errors.Delivered,
+				Signatures: sets,
+			}, nil
+		}
+	}
+	return nil, errors.NotFound.WithFormat("%v not found", scope)
+}
+
+// writeCertificate records a certificate and points the identity's personal
+// bank at it. It returns the hash of the certificate's transaction.
+func (q *historyQuerier) writeCertificate(identity *url.URL, block uint64, cert map[string]any) [32]byte {
+	segments := func(items ...any) []byte {
+		return must1(json.Marshal(map[string]any{
+			"segements": []any{map[string]any{"segmentType": "data", "config": map[string]any{"dataItems": items}}},
+		}))
+	}
+	cert["target"] = "main"
+	certAccount := url.MustParse("aml.acme/certificates")
+	q.write(certAccount, block, segments(cert))
+	chain := q.chains[certAccount.String()]
+	hash := chain[len(chain)-1].txn.GetHash()
+	q.write(identity.JoinPath("discoveryV1ClientDefault_personalbank", "Info_V1"), block, segments(map[string]any{
+		"target":         "primaryAml",
+		"certificateUrl": fmt.Sprintf("acc://%x", hash),
+	}))
+	return [32]byte(hash)
+}
+
+func TestReplay(t *testing.T) {
+	q := newHistoryQuerier()
+	identity := url.MustParse("alice.acme")
+	policy := url.MustParse("aml.acme/policy")
+
+	// Block 10: a certificate that failed, under the built-in ruleset
+	q.writeCertificate(identity, 10, map[string]any{
+		"certificationStatus": "failed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	})
+	q.write(policy, 10, must1(os.ReadFile("compiled_edd.xml")), must1(os.ReadFile("compiled_dt.xml")))
+
+	// Block 20: a certificate that passed, and a ruleset that denies everyone
+	q.writeCertificate(identity, 20, map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	})
+	closed := testFiles(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>true cvb /denied xdef "Closed" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`)
+	latest := q.write(policy, 20, closed["compiled_edd.xml"].Data, closed["compiled_dt.xml"].Data)
+
+	rs, err := rules.FetchRuleset(context.Background(), q, rules.DefaultRulesetName, rules.DefaultEntryPoint, policy, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+	engine.SetSigningKey(must1(rules.ParseSigningKey("secp256k1:" + strings.Repeat("01", 32))))
+	engine.SetEip712Domain(rules.CitreaTestnet)
+
+	replay := func(m *rules.Moment) *rules.Result {
+		t.Helper()
+		res, err := engine.Execute(context.Background(), q, &rules.Request{Identity: identity, Replay: m})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// As of block 15 the first certificate and ruleset were in force
+	height := uint64(15)
+	res := replay(&rules.Moment{Height: &height})
+	if res.Replay.PersonalBank.Block != 10 || res.Replay.Ruleset.Block != 10 {
+		t.Fatalf("want the entries of block 10, got %+v", res.Replay)
+	}
+	if res.Ruleset.Hash != fmt.Sprintf("%x", rules.DefaultRuleset().Hash) || !res.AsOf.Equal(blockTime(10)) {
+		t.Fatalf("want the built-in ruleset as of block 10, got %s as of %v", res.Ruleset.Hash, res.AsOf)
+	}
+	if len(res.Reasons) != 1 || res.Reasons[0].Code != "CERT_FAILED" {
+		t.Fatalf("want CERT_FAILED, got %+v", res.Reasons)
+	}
+
+	// The signed decision records the moment and is not live
+	s := must1(rules.VerifyAttestation(res.Attestation))
+	d := must1(rules.VerifyTypedDecision(res.Eip712))
+	if s.Live || s.Replay == nil || *s.Replay.Height != height || d.Live || d.ReplayHeight != height {
+		t.Fatalf("want a replay of block %d that is not live, got %+v and %+v", height, s, d)
+	}
+
+	// As of a later time the second certificate and ruleset were in force
+	at := blockTime(25)
+	res = replay(&rules.Moment{Time: &at})
+	if res.Replay.PersonalBank.Block != 20 || res.Ruleset.Hash != fmt.Sprintf("%x", latest) || !res.AsOf.Equal(at) {
+		t.Fatalf("want the entries of block 20 as of %v, got %+v as of %v", at, res.Replay, res.AsOf)
+	}
+	if !res.Denied || res.DenialReason.([]any)[0] != "Closed" {
+		t.Fatalf("want denied by the latest ruleset, got %v", res.DenialReason)
+	}
+
+	// Nothing was recorded before block 10
+	before := blockTime(5)
+	_, err = engine.Execute(context.Background(), q, &rules.Request{Identity: identity, Replay: &rules.Moment{Time: &before}})
+	if err == nil {
+		t.Fatal("want an error before the first entry")
+	}
+}
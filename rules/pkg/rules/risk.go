@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+)
+
+// RiskTier is a grade of the risk of a certificate.
+type RiskTier string
+
+const (
+	RiskLow        RiskTier = "low"
+	RiskMedium     RiskTier = "medium"
+	RiskHigh       RiskTier = "high"
+	RiskProhibited RiskTier = "prohibited"
+)
+
+// Recommended actions for the caller.
+const (
+	ActionAllow        = "allow"
+	ActionStepUp       = "step-up"
+	ActionManualReview = "manual-review"
+	ActionDeny         = "deny"
+)
+
+// RiskThresholds are the scores at which a certificate moves to the medium
+// and high tiers.
+type RiskThresholds struct {
+	Medium float64 `json:"medium"`
+	High   float64 `json:"high"`
+}
+
+var DefaultRiskThresholds = RiskThresholds{Medium: 30, High: 70}
+
+// riskFields are added to the result entity of every ruleset that does not
+// declare them, so decision tables can accumulate a score, e.g. with
+// `riskScore 25 + /riskScore xdef`, set the tier, add recommended actions, or
+// add reasons to review a certificate that is not denied.
+var riskFields = dt.EntityDefinition{
+	"riskScore":          {Type: vm.NumberType, Default: must1(vm.AsValue(0)), Writable: true},
+	"riskTier":           {Type: vm.StringType, Default: vm.Null, Writable: true},
+	"recommendedActions": {Type: vm.ArrayType, Default: &vm.LiteralArray{}, Writable: true},
+	"reviewReason":       {Type: vm.ArrayType, Default: &vm.LiteralArray{}, Writable: true},
+}
+
+func addRiskFields(entities map[string]dt.EntityDefinition) {
+	result, ok := entities["result"]
+	if !ok {
+		return
+	}
+	for name, f := range riskFields {
+		if _, ok := result[name]; !ok {
+			result[name] = f
+		}
+	}
+}
+
+// grade sets the risk tier and recommended actions of the result. A tier or
+// actions set by the decision tables take precedence. Otherwise the tier is
+// derived from the score and the actions from the tier, except that a
+// certificate with review reasons is always reviewed. A denied certificate is
+// always prohibited, and a prohibited certificate is always denied.
+func (t RiskThresholds) grade(res *Result) error {
+	switch {
+	case res.Denied:
+		res.RiskTier = RiskProhibited
+	case res.RiskTier != "":
+		res.RiskTier = RiskTier(strings.ToLower(string(res.RiskTier)))
+		switch res.RiskTier {
+		case RiskLow, RiskMedium, RiskHigh:
+		case RiskProhibited:
+			res.Denied = true
+		default:
+			return fmt.Errorf("invalid risk tier %q", res.RiskTier)
+		}
+	case res.RiskScore >= t.High:
+		res.RiskTier = RiskHigh
+	case res.RiskScore >= t.Medium:
+		res.RiskTier = RiskMedium
+	default:
+		res.RiskTier = RiskLow
+	}
+
+	if res.RiskTier == RiskProhibited {
+		res.RecommendedActions = []string{ActionDeny}
+	}
+	if len(res.RecommendedActions) > 0 {
+		return nil
+	}
+	if len(res.ReviewReasons) > 0 {
+		res.RecommendedActions = []string{ActionManualReview}
+		return nil
+	}
+	switch res.RiskTier {
+	case RiskLow:
+		res.RecommendedActions = []string{ActionAllow}
+	case RiskMedium:
+		res.RecommendedActions = []string{ActionStepUp}
+	case RiskHigh:
+		res.RecommendedActions = []string{ActionManualReview}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package rules_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+// riskRuleset builds a ruleset with a table that adds 40 to the score for an
+// update and 40 for a pending certification.
+func riskRuleset(t *testing.T, config string) *rules.Ruleset {
+	t.Helper()
+	var files []string
+	if config != "" {
+		files = []string{"ruleset.json", config}
+	}
+	return testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<attribute_fields><TYPE>ALL</TYPE></attribute_fields>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>dataOperationType "update" s==</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+<condition_details>
+<condition_number>2</condition_number>
+<condition_postfix>certificationStatus "pending" s==</condition_postfix>
+<condition_column column_number="2" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>riskScore 40 + /riskScore xdef</action_postfix>
+<action_column column_number="1" column_value="X"></action_column>
+<action_column column_number="2" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`, files...)
+}
+
+func TestRiskScore(t *testing.T) {
+	cases := []struct {
+		config, status, operation string
+		score                     float64
+		tier                      rules.RiskTier
+		action                    string
+	}{
+		{"", "passed", "create", 0, rules.RiskLow, rules.ActionAllow},
+		{"", "passed", "update", 40, rules.RiskMedium, rules.ActionStepUp},
+		{"", "pending", "update", 80, rules.RiskHigh, rules.ActionManualReview},
+		{`{"riskThresholds": {"medium": 50, "high": 100}}`, "passed", "update", 40, rules.RiskLow, rules.ActionAllow},
+	}
+	for _, c := range cases {
+		engine := rules.NewEngine(must1(rules.NewRegistry(riskRuleset(t, c.config))))
+		cert := rules.NewCertificate(map[string]any{
+			"certificationStatus": c.status,
+			"dataOperationType":   c.operation,
+			"fromDate":            "2024-01-01",
+			"toDate":              "2099-01-01",
+		})
+		res, err := engine.Evaluate(context.Background(), &rules.Request{}, cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.RiskScore != c.score || res.RiskTier != c.tier || !slices.Equal(res.RecommendedActions, []string{c.action}) {
+			t.Errorf("%s/%s: want %v %s %s, got %v %s %v", c.status, c.operation, c.score, c.tier, c.action, res.RiskScore, res.RiskTier, res.RecommendedActions)
+		}
+	}
+}
+
+func TestRiskDenied(t *testing.T) {
+	fixtures := must1(rules.LoadFixtures(os.DirFS("testdata/fixtures")))
+	for _, r := range rules.NewEngine(rules.DefaultRegistry()).RunFixtures(context.Background(), fixtures) {
+		want := rules.RiskLow
+		if r.Fixture.Expect.Denied {
+			want = rules.RiskProhibited
+		}
+		if r.Result.RiskTier != want {
+			t.Errorf("%s: want tier %s, got %s", r.Fixture.Name, want, r.Result.RiskTier)
+		}
+	}
+}
+
+func TestRiskProhibited(t *testing.T) {
+	// A table that prohibits every certificate without giving a reason
+	rs := testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>"prohibited" /riskTier xdef</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`)
+	cert := rules.NewCertificate(map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2099-01-01",
+	})
+	res, err := rules.NewEngine(must1(rules.NewRegistry(rs))).Evaluate(context.Background(), &rules.Request{Locale: "de"}, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied || len(res.Reasons) != 1 || res.Reasons[0].Code != "RISK_PROHIBITED" || res.Reasons[0].Message != "Die Risikostufe ist untersagt" {
+		t.Fatalf("want denied with a fallback reason, got %+v", res.Reasons)
+	}
+}
@@ -2,33 +2,141 @@ package rules
 
 import (
 	"context"
-	"embed"
-	"encoding/xml"
-	"fmt"
-	"io"
+	"slices"
+	"time"
 
 	"github.com/C3Rules/Go-DTRules/pkg/dt"
-	lxml "github.com/C3Rules/Go-DTRules/pkg/legacy/xml"
 	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/accumulate"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3/jsonrpc"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
 )
 
-//go:embed *.xml
-var files embed.FS
-
-var entities = must1(loadAnd("compiled_edd.xml", lxml.EDD.Compile))
-var tables = must1(loadAnd("compiled_dt.xml", lxml.DT.Compile))
-
 type Request struct {
-	Identity *url.URL
+	Identity *url.URL `json:"identity"`
+
+	// Transaction screens a transfer instead of an identity. The
+	// certificates of both parties are evaluated with the transaction.
+	Transaction *Transaction `json:"transaction,omitempty"`
+
+	// Ruleset is the name of the ruleset to execute. If it is empty the
+	// default ruleset is used.
+	Ruleset string `json:"ruleset,omitempty"`
+
+	// Explain requests a trace of the conditions, cases, and actions that
+	// were evaluated.
+	Explain bool `json:"explain,omitempty"`
+
+	// Locale is the preferred locale of the denial messages, or a list of
+	// locales in the format of an Accept-Language header.
+	Locale string `json:"locale,omitempty"`
+
+	// AsOf is the time to evaluate the certificate at. If it is nil the
+	// engine's clock is used.
+	AsOf *time.Time `json:"asOf,omitempty"`
+
+	// Aggregation overrides the ruleset's policy for combining the results of
+	// an identity with several certificates. It cannot be set by a remote
+	// caller, who could otherwise weaken the policy.
+	Aggregation Aggregation `json:"-"`
+
+	// History is the transfer history of the identity or, for a transaction,
+	// of the sender. If it is nil and the ruleset uses it, it is computed from
+	// the chain of commands. It cannot be set by a remote caller.
+	History *History `json:"-"`
+
+	// Replay evaluates the personal bank and certificate entries, and the
+	// version of the ruleset if it is published to a data account, that were
+	// in force at a past moment instead of the latest ones.
+	Replay *Moment `json:"replay,omitempty"`
+
+	// UserOpHash is the hash of the ERC-4337 UserOperation the decision is
+	// for, as 32 bytes of hex. It is signed with the decision so the decision
+	// cannot be presented with another operation.
+	UserOpHash string `json:"userOpHash,omitempty"`
 }
 
 type Result struct {
 	Denied       bool `json:"denied"`
 	DenialReason any  `json:"denialReason"`
+
+	// Reasons are the denial reasons as codes, with messages rendered for
+	// Locale.
+	Reasons []*Reason `json:"reasons,omitempty"`
+	Locale  string    `json:"locale,omitempty"`
+
+	// ReviewReasons are the reasons the tables added to reviewReason, for a
+	// certificate that should be reviewed but is not necessarily denied.
+	ReviewReasons []*Reason `json:"reviewReasons,omitempty"`
+
+	// RiskScore is the sum of the score contributions of the decision tables.
+	// RiskTier and RecommendedActions are set by the tables or derived from
+	// the score.
+	RiskScore          float64  `json:"riskScore"`
+	RiskTier           RiskTier `json:"riskTier"`
+	RecommendedActions []string `json:"recommendedActions"`
+
+	Ruleset *RulesetRef `json:"ruleset,omitempty"`
+
+	// AsOf is the time the certificate was evaluated at. Evaluating the same
+	// certificate with the same ruleset as of this time reproduces the result.
+	AsOf time.Time `json:"asOf"`
+
+	// Issuer is the trusted signer of the certificate, if the ruleset only
+	// trusts certain issuers.
+	Issuer *Signer `json:"issuer,omitempty"`
+
+	// Aggregation and Certificates are set if the identity has several
+	// certificates. Certificates holds the result of each one, the primary
+	// first, and the fields above are their combination.
+	Aggregation  Aggregation          `json:"aggregation,omitempty"`
+	Certificates []*CertificateResult `json:"certificates,omitempty"`
+
+	// Parties holds the result of the sender and of the recipient of a
+	// screened transaction. The fields above are their combination.
+	Parties []*PartyResult `json:"parties,omitempty"`
+
+	// EvmAddress is the screening of a transaction's recipient, if it is an
+	// EVM address.
+	EvmAddress *EvmAddress `json:"evmAddress,omitempty"`
+
+	// SanctionsHits are the sanctions list entries the tables matched, the
+	// best hit of each entry.
+	SanctionsHits []*sanctions.Hit `json:"sanctionsHits,omitempty"`
+
+	// Proofs are the receipts of the personal bank and certificate entries the
+	// result is based on, if the engine has trusted anchors.
+	Proofs []*Proof `json:"proofs,omitempty"`
+
+	// Replay identifies the entries a replayed result is based on.
+	Replay *ReplayRecord `json:"replay,omitempty"`
+
+	Explain *Explanation `json:"explain,omitempty"`
+
+	// SchemaViolations lists the certificate fields that do not match the
+	// EDD. If there are any, the certificate is denied without executing the
+	// ruleset.
+	SchemaViolations []*SchemaViolation `json:"schemaViolations,omitempty"`
+
+	// Attestation is the signed statement of the decision, if the engine has
+	// a signing key.
+	Attestation *Attestation `json:"attestation,omitempty"`
+
+	// Eip712 is the decision signed as EIP-712 typed data, if the engine has
+	// an EIP-712 domain, so a contract can check it.
+	Eip712 *TypedDecision `json:"eip712,omitempty"`
+
+	// certificates are the IDs of the certificates the result is based on.
+	certificates [][32]byte
+}
+
+// RulesetRef identifies the ruleset that produced a result.
+type RulesetRef struct {
+	Name    string   `json:"name"`
+	Hash    string   `json:"hash"`
+	Account *url.URL `json:"account,omitempty"`
 }
 
 func Main(endpoint string, adi string) (*Result, error) {
@@ -39,34 +147,24 @@ func Main(endpoint string, adi string) (*Result, error) {
 }
 
 func Execute(ctx context.Context, client api.Querier, req *Request) (*Result, error) {
-	if req.Identity == nil {
-		return nil, fmt.Errorf("missing metadata URL")
-	}
-
-	id, err := FetchAmlCertID(ctx, client, req.Identity)
-	if err != nil {
-		return nil, err
-	}
-
-	cert, err := FetchAmlCert(ctx, client, id)
-	if err != nil {
-		return nil, err
-	}
-
-	s := vm.New()
-	s.SetContext(ctx)
-	result := entities["result"].New("result")
-	must(s.Entity().Push(tables, result, cert))
+	return defaultEngine.Execute(ctx, client, req)
+}
 
-	err = vm.ExecuteString(s, "Validate_Certificate")
-	if err != nil {
-		return nil, err
+// newEntity creates an entity from its definition. [dt.EntityDefinition.New]
+// shares default values between entities, so array defaults are copied to
+// prevent one execution from appending to another's array.
+func newEntity(defs map[string]dt.EntityDefinition, name string) *dt.Entity {
+	def := defs[name]
+	e := def.New(name)
+	for field, f := range def {
+		a, ok := f.Default.(*vm.LiteralArray)
+		if !ok {
+			continue
+		}
+		b := slices.Clone(*a)
+		must(e.Set(field, &b))
 	}
-
-	return &Result{
-		Denied:       getFieldAs(s, result, "denied", vm.AsBool),
-		DenialReason: getFieldAs(s, result, "denialReason", vm.AsAny),
-	}, nil
+	return e
 }
 
 func getFieldAs[V any](s vm.State, entity *dt.Entity, name string, as func(vm.Value) (V, error)) V {
@@ -75,29 +173,6 @@ func getFieldAs[V any](s vm.State, entity *dt.Entity, name string, as func(vm.Va
 	return must1(as(value))
 }
 
-func loadAnd[V, U any](filename string, and func(V) (U, error)) (U, error) {
-	f, err := files.Open(filename)
-	if err != nil {
-		var z U
-		return z, err
-	}
-	b, err := io.ReadAll(f)
-	if err != nil {
-		var z U
-		return z, err
-	}
-
-	var v V
-	err = xml.Unmarshal(b, &v)
-	err = xml.Unmarshal(b, &v)
-	if err != nil {
-		var z U
-		return z, err
-	}
-
-	return and(v)
-}
-
 func must(err error) {
 	if err != nil {
 		panic(err)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
 	"gitlab.com/accumulatenetwork/accumulate/pkg/accumulate"
@@ -11,10 +12,13 @@ import (
 	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
 )
 
-func ExampleExecuteWithEndpoint() {
+func ExampleExecute() {
 	client := jsonrpc.NewClient(accumulate.ResolveWellKnownEndpoint("kermit", "v3"))
+	// Evaluate as of a fixed time so the result is reproducible
+	asOf := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
 	res, err := rules.Execute(context.Background(), client, &rules.Request{
 		Identity: url.MustParse("FrankRagnok.acme"),
+		AsOf:     &asOf,
 	})
 	if err != nil {
 		panic(err)
@@ -30,7 +34,27 @@ func ExampleExecuteWithEndpoint() {
 	//   "denied": true,
 	//   "denialReason": [
 	//     "Certification failed"
-	//   ]
+	//   ],
+	//   "reasons": [
+	//     {
+	//       "code": "CERT_FAILED",
+	//       "params": {
+	//         "certificationStatus": "failed"
+	//       },
+	//       "message": "Certification failed"
+	//     }
+	//   ],
+	//   "locale": "en",
+	//   "riskScore": 0,
+	//   "riskTier": "prohibited",
+	//   "recommendedActions": [
+	//     "deny"
+	//   ],
+	//   "ruleset": {
+	//     "name": "default",
+	//     "hash": "8ebdfa7d9f68bf55a4c66f8f496ed54f79143464a9fa36a16098114f4bfcfe8a"
+	//   },
+	//   "asOf": "2024-06-01T12:00:00Z"
 	// }
 	fmt.Println(string(b))
 }
@@ -0,0 +1,519 @@
+package rules
+
+import (
+	"context"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/C3Rules/Go-DTRules/pkg/dt"
+	lxml "github.com/C3Rules/Go-DTRules/pkg/legacy/xml"
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+	"gitlab.com/accumulatenetwork/accumulate/protocol"
+)
+
+// The compiled files are generated from the workbooks
+//go:generate go run ../.. compile .
+
+//go:embed *.xml
+var files embed.FS
+
+const (
+	eddFile    = "compiled_edd.xml"
+	dtFile     = "compiled_dt.xml"
+	configFile = "ruleset.json"
+)
+
+const (
+	// DefaultRulesetName is the name of the ruleset used when a request does
+	// not specify one.
+	DefaultRulesetName = "default"
+
+	// DefaultEntryPoint is the table executed when a ruleset does not specify
+	// an entry point.
+	DefaultEntryPoint = "Validate_Certificate"
+)
+
+// Ruleset is a compiled entity data dictionary and the decision tables that
+// operate on it.
+type Ruleset struct {
+	Name     string
+	Entry    string
+	Entities map[string]dt.EntityDefinition
+	Tables   vm.Entity
+
+	// Hash is the hash of the ruleset as an Accumulate data entry, where the
+	// first part is the compiled EDD and the second is the compiled decision
+	// tables. For a ruleset fetched from the network, this is the hash of the
+	// entry it was read from.
+	Hash [32]byte
+
+	// Account is the data account the ruleset was fetched from, if any.
+	Account *url.URL
+
+	// RiskThresholds are used to derive the risk tier from the risk score.
+	RiskThresholds RiskThresholds
+
+	// Aggregation combines the results of an identity with several
+	// certificates.
+	Aggregation Aggregation
+
+	// TrustedIssuers are the authorities that may sign certificates. If there
+	// are any, a certificate that none of them signed is denied.
+	TrustedIssuers []*TrustedIssuer
+
+	// HistoryToken is the token whose transfers the history aggregates when
+	// screening an identity rather than a transaction.
+	HistoryToken string
+
+	// dates are the certificate fields the tables convert to dates.
+	dates map[string]bool
+
+	// columns are the column numbers of the cases of each table in the
+	// decision table source.
+	columns map[string][]int
+
+	// txn is the transaction that published the ruleset, if it was fetched
+	// from an account.
+	txn *protocol.Transaction
+}
+
+// caseNumber returns the column number of a table's case in the decision
+// table source.
+func (rs *Ruleset) caseNumber(table string, i int) int {
+	if cols := rs.columns[table]; i < len(cols) {
+		return cols[i]
+	}
+	return i + 1
+}
+
+func (rs *Ruleset) ref() *RulesetRef {
+	return &RulesetRef{
+		Name:    rs.Name,
+		Hash:    hex.EncodeToString(rs.Hash[:]),
+		Account: rs.Account,
+	}
+}
+
+// rulesetConfig is the format of the optional ruleset.json that accompanies
+// the compiled files.
+type rulesetConfig struct {
+	Entry string `json:"entry"`
+
+	// Account and Hash pin the ruleset to an entry of a data account. If they
+	// are set, the compiled files are fetched from the network instead of the
+	// file system.
+	Account *url.URL `json:"account"`
+	Hash    string   `json:"hash"`
+
+	RiskThresholds *RiskThresholds  `json:"riskThresholds"`
+	Aggregation    Aggregation      `json:"aggregation"`
+	TrustedIssuers []*TrustedIssuer `json:"trustedIssuers"`
+	HistoryToken   string           `json:"historyToken"`
+}
+
+var defaultRegistry = must1(NewRegistry(must1(LoadRuleset(context.Background(), nil, DefaultRulesetName, files))))
+
+// DefaultRegistry returns a registry containing the ruleset that is compiled
+// into the binary. The registry is a copy, so the caller may modify it.
+func DefaultRegistry() Registry { return maps.Clone(defaultRegistry) }
+
+// DefaultRuleset returns the ruleset that is compiled into the binary.
+func DefaultRuleset() *Ruleset { return defaultRegistry[DefaultRulesetName] }
+
+// LoadRuleset compiles the EDD and decision tables found in the root of the
+// file system. If the file system contains a ruleset.json, the entry point is
+// read from it. If ruleset.json pins the ruleset to a data account entry, the
+// ruleset is fetched using the client instead.
+func LoadRuleset(ctx context.Context, client api.Querier, name string, fsys fs.FS) (*Ruleset, error) {
+	config := rulesetConfig{Entry: DefaultEntryPoint}
+	b, err := fs.ReadFile(fsys, configFile)
+	switch {
+	case err == nil:
+		err = json.Unmarshal(b, &config)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", configFile, err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("load %s: %w", configFile, err)
+	}
+	if t := config.RiskThresholds; t != nil && t.Medium > t.High {
+		return nil, fmt.Errorf("load %s: the medium risk threshold is greater than the high threshold", configFile)
+	}
+	if config.Aggregation != "" {
+		err = config.Aggregation.valid()
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", configFile, err)
+		}
+	}
+	for i, t := range config.TrustedIssuers {
+		if t == nil || t.Authority == nil {
+			return nil, fmt.Errorf("load %s: trusted issuer %d has no authority", configFile, i+1)
+		}
+		if t.From != nil && t.Until != nil && !t.From.Before(*t.Until) {
+			return nil, fmt.Errorf("load %s: trusted issuer %v is trusted until before it is trusted from", configFile, t.Authority)
+		}
+	}
+	rs, err := loadRuleset(ctx, client, name, fsys, &config)
+	if err != nil {
+		return nil, err
+	}
+	if config.RiskThresholds != nil {
+		rs.RiskThresholds = *config.RiskThresholds
+	}
+	if config.Aggregation != "" {
+		rs.Aggregation = config.Aggregation
+	}
+	rs.TrustedIssuers = config.TrustedIssuers
+	rs.HistoryToken = strings.TrimSpace(config.HistoryToken)
+	return rs, nil
+}
+
+func loadRuleset(ctx context.Context, client api.Querier, name string, fsys fs.FS, config *rulesetConfig) (*Ruleset, error) {
+
+	if config.Account != nil || config.Hash != "" {
+		if config.Account == nil || config.Hash == "" {
+			return nil, fmt.Errorf("load %s: account and hash must be specified together", configFile)
+		}
+		hash, err := parseHash(config.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", configFile, err)
+		}
+		if client == nil {
+			return nil, fmt.Errorf("ruleset is pinned to %v but no client was provided", config.Account)
+		}
+		return FetchRuleset(ctx, client, name, config.Entry, config.Account, hash)
+	}
+
+	eddXml, err := fs.ReadFile(fsys, eddFile)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", eddFile, err)
+	}
+	dtXml, err := fs.ReadFile(fsys, dtFile)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", dtFile, err)
+	}
+
+	entry := &protocol.DoubleHashDataEntry{Data: [][]byte{eddXml, dtXml}}
+	return compileRuleset(name, config.Entry, [32]byte(entry.Hash()), eddXml, dtXml)
+}
+
+func compileRuleset(name, entry string, hash [32]byte, eddXml, dtXml []byte) (*Ruleset, error) {
+	entities, tables, columns, err := compileTables(eddXml, dtXml)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := tables.Field(vm.LiteralName(entry)); !ok {
+		return nil, fmt.Errorf("entry point %q is not a decision table", entry)
+	}
+
+	return &Ruleset{
+		Name:           name,
+		Entry:          entry,
+		Entities:       entities,
+		Tables:         tables,
+		Hash:           hash,
+		RiskThresholds: DefaultRiskThresholds,
+		Aggregation:    DefaultAggregation,
+		dates:          dateFields(tables),
+		columns:        columns,
+	}, nil
+}
+
+// compileTables compiles the EDD and decision tables. It also returns the
+// column number of each case of each table, since the cases are reordered.
+func compileTables(eddXml, dtXml []byte) (map[string]dt.EntityDefinition, vm.Entity, map[string][]int, error) {
+	entities, err := compileXml(eddXml, lxml.EDD.Compile)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("compile EDD: %w", err)
+	}
+	addRiskFields(entities)
+
+	var x lxml.DT
+	err = xml.Unmarshal(dtXml, &x)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("compile decision tables: %w", err)
+	}
+	for _, t := range x.Slice {
+		rewriteIgnoreCase(t)
+	}
+	tables, err := x.Compile()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("compile decision tables: %w", err)
+	}
+
+	// The legacy compiler ignores the table type so every table would execute
+	// the first matching case, and orders cases by the first condition or
+	// action that refers to them instead of by column
+	modes := map[string]dt.Mode{}
+	columns := map[string][]int{}
+	for _, t := range x.Slice {
+		seen := map[int]bool{}
+		add := func(n int) {
+			if !seen[n] {
+				seen[n] = true
+				columns[t.TableName] = append(columns[t.TableName], n)
+			}
+		}
+		for _, c := range t.Conditions {
+			for _, col := range c.Columns {
+				add(col.Number)
+			}
+		}
+		for _, a := range t.Actions {
+			for _, col := range a.Columns {
+				add(col.Number)
+			}
+		}
+
+		for _, attr := range t.AttributeFields {
+			if !strings.EqualFold(attr.Name, "TYPE") {
+				continue
+			}
+			switch strings.ToUpper(strings.TrimSpace(attr.Value)) {
+			case "", "FIRST":
+			case "ALL":
+				modes[t.TableName] = dt.ModeAll
+			default:
+				return nil, nil, nil, fmt.Errorf("compile decision tables: table %s: unsupported type %q", t.TableName, attr.Value)
+			}
+		}
+	}
+	_ = forEachTable(tables, func(name string, table *dt.DecisionTable) error {
+		table.Mode = modes[name]
+		if cols := columns[name]; len(cols) == len(table.Cases) {
+			order := make([]int, len(cols))
+			for i := range order {
+				order[i] = i
+			}
+			sort.SliceStable(order, func(i, j int) bool { return cols[order[i]] < cols[order[j]] })
+			cases := make([]*dt.Case, len(order))
+			for i, j := range order {
+				cases[i] = table.Cases[j]
+			}
+			table.Cases = cases
+			slices.Sort(cols)
+		} else {
+			delete(columns, name)
+		}
+		return nil
+	})
+
+	rebindGetDate(tables)
+
+	err = checkOperators(entities, tables)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return entities, tables, columns, nil
+}
+
+// Registry is a set of rulesets, indexed by lower-case name.
+type Registry map[string]*Ruleset
+
+// NewRegistry returns a registry containing the given rulesets. Ruleset names
+// must be unique, ignoring case.
+func NewRegistry(rulesets ...*Ruleset) (Registry, error) {
+	r := Registry{}
+	for _, rs := range rulesets {
+		err := r.Add(rs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add adds a ruleset to the registry.
+func (r Registry) Add(rs *Ruleset) error {
+	key := strings.ToLower(rs.Name)
+	if _, ok := r[key]; ok {
+		return fmt.Errorf("duplicate ruleset %q", rs.Name)
+	}
+	r[key] = rs
+	return nil
+}
+
+// Get returns the named ruleset, or the default ruleset if the name is empty.
+func (r Registry) Get(name string) (*Ruleset, error) {
+	if name == "" {
+		name = DefaultRulesetName
+	}
+	rs, ok := r[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown ruleset %q", name)
+	}
+	return rs, nil
+}
+
+// Names returns the names of the registered rulesets in sorted order.
+func (r Registry) Names() []string {
+	var names []string
+	for _, rs := range r {
+		names = append(names, rs.Name)
+	}
+	sort.Strings(names)
+	return slices.Compact(names)
+}
+
+// LoadRegistry loads every ruleset in the file system. If the root contains a
+// compiled EDD or a ruleset.json it is loaded as the default ruleset. Each
+// subdirectory that contains either is loaded as a ruleset named after the
+// subdirectory. If there is no ruleset named default and exactly one ruleset
+// is found, that ruleset is also used as the default. The client is used to
+// fetch rulesets that are pinned to a data account, and may be nil if there
+// are none.
+func LoadRegistry(ctx context.Context, client api.Querier, fsys fs.FS) (Registry, error) {
+	r := Registry{}
+	load := func(name, dir string) error {
+		sub, err := fs.Sub(fsys, dir)
+		if err != nil {
+			return err
+		}
+		rs, err := LoadRuleset(ctx, client, name, sub)
+		if err != nil {
+			return fmt.Errorf("ruleset %s: %w", name, err)
+		}
+		return r.Add(rs)
+	}
+
+	if isRulesetDir(fsys, ".") {
+		err := load(DefaultRulesetName, ".")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if !isRulesetDir(fsys, entry.Name()) {
+			continue
+		}
+		err = load(entry.Name(), entry.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch len(r) {
+	case 0:
+		return nil, errors.New("no rulesets found")
+	case 1:
+		for _, rs := range r {
+			r[DefaultRulesetName] = rs
+		}
+	}
+	return r, nil
+}
+
+// LoadRegistryDir loads every ruleset in the directory. See [LoadRegistry].
+func LoadRegistryDir(ctx context.Context, client api.Querier, dir string) (Registry, error) {
+	return LoadRegistry(ctx, client, os.DirFS(dir))
+}
+
+func isRulesetDir(fsys fs.FS, dir string) bool {
+	for _, file := range []string{eddFile, configFile} {
+		if _, err := fs.Stat(fsys, path.Join(dir, file)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func compileXml[V, U any](b []byte, and func(V) (U, error)) (U, error) {
+	var v V
+	err := xml.Unmarshal(b, &v)
+	if err != nil {
+		var z U
+		return z, err
+	}
+
+	return and(v)
+}
+
+func parseHash(s string) ([32]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("invalid hash: %w", err)
+	}
+	if len(b) != 32 {
+		return [32]byte{}, fmt.Errorf("invalid hash: want 32 bytes, got %d", len(b))
+	}
+	return [32]byte(b), nil
+}
+
+// forEachTable calls the function for each decision table in the tables
+// entity.
+func forEachTable(tables vm.Entity, fn func(name string, table *dt.DecisionTable) error) error {
+	t, ok := tables.(lxml.TablesEntity)
+	if !ok {
+		return fmt.Errorf("unsupported tables entity %T", tables)
+	}
+	for _, v := range t {
+		named, ok := v.Value.(*vm.Named)
+		if !ok {
+			continue
+		}
+
+		// A table with a context is wrapped in an executable array
+		value := named.Value
+		for {
+			a, ok := value.(*vm.ExecutableArray)
+			if !ok || len(*a) == 0 {
+				break
+			}
+			value = (*a)[0]
+		}
+		table, ok := value.(*dt.DecisionTable)
+		if !ok {
+			continue
+		}
+		err := fn(named.Name, table)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The VM maps sic== to the case-sensitive comparison, so it is replaced with
+// a host operator before the tables are compiled.
+var ignoreCaseOp = regexp.MustCompile(`(?i)(^|\s)(sic==|streqignorecase)(\s|$)`)
+
+func rewriteIgnoreCase(t *lxml.DecisionTable) {
+	rewrite := func(s *string) {
+		*s = ignoreCaseOp.ReplaceAllString(*s, "${1}equalsIgnoreCase${3}")
+	}
+	for _, c := range t.Contexts {
+		rewrite(&c.Postfix)
+	}
+	for _, a := range t.InitialActions {
+		rewrite(&a.Postfix)
+	}
+	for _, c := range t.Conditions {
+		rewrite(&c.Postfix)
+	}
+	for _, a := range t.Actions {
+		rewrite(&a.Postfix)
+	}
+}
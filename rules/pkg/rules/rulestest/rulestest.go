@@ -0,0 +1,29 @@
+// Package rulestest runs rule fixtures as Go tests.
+package rulestest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+// Run loads the fixtures in the directory and runs each as a subtest of t.
+// See [rules.Fixture] for the format of a fixture.
+func Run(t *testing.T, engine *rules.Engine, dir string) {
+	t.Helper()
+	fixtures, err := rules.LoadFixtures(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range fixtures {
+		t.Run(f.Name, func(t *testing.T) {
+			r := engine.RunFixture(context.Background(), f)
+			for _, failure := range r.Failures {
+				t.Errorf("%s: %s", f.File, failure)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
+)
+
+// The sanctions operators screen a name against the engine's sanctions list:
+//
+//	name minScore sanctionsMatch
+//	    True if the name matches an entry with at least the minimum score,
+//	    between 0 and 1. The matching entries are added to the result.
+//	name sanctionsScore
+//	    The score of the entry that matches the name best, or 0.
+//
+// For example, `holderName 0.85 sanctionsMatch` is true if the holder's name
+// is on the list. A null name matches nothing.
+var sanctionsOperators = []Operator{opSanctionsMatch, opSanctionsScore}
+
+var opSanctionsMatch = Operator{
+	Name:    "sanctionsMatch",
+	Args:    []vm.Type{AnyType, vm.NumberType},
+	Results: []vm.Type{vm.BooleanType},
+	Fn: func(s vm.State) error {
+		v, err := s.Data().Pop(2)
+		if err != nil {
+			return err
+		}
+		minScore, err := vm.AsFloat(v[1])
+		if err != nil {
+			return err
+		}
+		hits, err := screenName(s, v[0], minScore)
+		if err != nil {
+			return err
+		}
+		if len(hits) == 0 {
+			return s.Data().Push(vm.False)
+		}
+		if sc, ok := s.Context().Value(screeningKey{}).(*screening); ok {
+			sc.add(hits)
+		}
+		return s.Data().Push(vm.True)
+	},
+}
+
+var opSanctionsScore = Operator{
+	Name:    "sanctionsScore",
+	Args:    []vm.Type{AnyType},
+	Results: []vm.Type{vm.NumberType},
+	Fn: func(s vm.State) error {
+		v, err := s.Data().Pop(1)
+		if err != nil {
+			return err
+		}
+		hits, err := screenName(s, v[0], 0)
+		if err != nil {
+			return err
+		}
+		var score float64
+		if len(hits) > 0 {
+			score = hits[0].Score
+		}
+		return s.Data().Push(must1(vm.AsValue(score)))
+	},
+}
+
+func screenName(s vm.State, v vm.Value, minScore float64) ([]*sanctions.Hit, error) {
+	sc, ok := s.Context().Value(screeningKey{}).(*screening)
+	if !ok || sc.list == nil {
+		return nil, errors.New("no sanctions list is loaded")
+	}
+	if v == vm.Null {
+		return nil, nil
+	}
+	name, err := vm.AsString(v)
+	if err != nil {
+		return nil, err
+	}
+	return sc.list.Search(name, minScore), nil
+}
+
+// screening collects the hits of an evaluation.
+type screening struct {
+	list *sanctions.List
+	mu   sync.Mutex
+	hits []*sanctions.Hit
+}
+
+type screeningKey struct{}
+
+func withScreening(ctx context.Context, list *sanctions.List) (context.Context, *screening) {
+	sc := &screening{list: list}
+	return context.WithValue(ctx, screeningKey{}, sc), sc
+}
+
+func (sc *screening) add(hits []*sanctions.Hit) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.hits = mergeHits(sc.hits, hits)
+}
+
+// mergeHits adds the hits to a list, keeping the best hit of each entry.
+func mergeHits(list, hits []*sanctions.Hit) []*sanctions.Hit {
+outer:
+	for _, h := range hits {
+		for i, g := range list {
+			if g.Entry == h.Entry || g.Entry.Source == h.Entry.Source && g.Entry.ID == h.Entry.ID {
+				if h.Score > g.Score {
+					list[i] = h
+				}
+				continue outer
+			}
+		}
+		list = append(list, h)
+	}
+	return list
+}
+
+// SetSanctions replaces the sanctions list the sanctions operators screen
+// against. A ruleset that calls them fails if no list is set.
+func (e *Engine) SetSanctions(l *sanctions.List) { e.sanctions.Store(l) }
+
+// Sanctions returns the sanctions list, or nil.
+func (e *Engine) Sanctions() *sanctions.List { return e.sanctions.Load() }
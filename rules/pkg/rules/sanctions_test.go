@@ -0,0 +1,71 @@
+package rules_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
+)
+
+func TestSanctionsScreening(t *testing.T) {
+	// An EDD with the name of the certificate's holder, and a table that
+	// denies holders on the sanctions list
+	edd := strings.Replace(string(must1(os.ReadFile("compiled_edd.xml"))),
+		"<field name='certificationStatus'",
+		"<field name='holderName' type='string' subtype='' access='r' input='' default_value='' comment=''></field>\n\t\t<field name='certificationStatus'", 1)
+	rs := testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>holderName 0.85 sanctionsMatch</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>true /denied xdef "SANCTIONS_MATCH" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`, "compiled_edd.xml", edd)
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+	evaluate := func(name any) (*rules.Result, error) {
+		cert := rules.NewCertificate(map[string]any{
+			"holderName":          name,
+			"certificationStatus": "passed",
+			"dataOperationType":   "create",
+			"fromDate":            "2024-01-01",
+			"toDate":              "2030-01-01",
+		})
+		return engine.Evaluate(context.Background(), &rules.Request{}, cert)
+	}
+
+	// Without a list the operator fails
+	_, err := evaluate("Vladimir Ivanov")
+	if err == nil {
+		t.Fatal("want an error without a sanctions list")
+	}
+
+	engine.SetSanctions(sanctions.NewList([]*sanctions.Entry{
+		{ID: "1001", Source: "sdn", Name: "Vladimir IVANOV", Aliases: []string{"Владимир ИВАНОВ"}},
+	}))
+	res, err := evaluate("Ivanov Wladimir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Denied || len(res.Reasons) != 1 || res.Reasons[0].Code != "SANCTIONS_MATCH" {
+		t.Fatalf("want denied for a sanctions match, got %+v", res)
+	}
+	if len(res.SanctionsHits) != 1 || res.SanctionsHits[0].Entry.ID != "1001" || res.SanctionsHits[0].Query != "Ivanov Wladimir" {
+		t.Fatalf("want the matched entry, got %+v", res.SanctionsHits)
+	}
+
+	res, err = evaluate("Maria Garcia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Denied || len(res.SanctionsHits) != 0 {
+		t.Fatalf("want allowed without hits, got %+v", res)
+	}
+}
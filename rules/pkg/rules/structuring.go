@@ -0,0 +1,169 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"github.com/ethereum/go-ethereum/common"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+// The structuring operators detect patterns in the transfer history. Their
+// thresholds and windows are arguments, so they are configured by the
+// decision tables that call them:
+//
+//	threshold margin hours structuringCount
+//	    The number of transfers of the history's token the identity sent in
+//	    the last hours that were at least threshold - margin and less than
+//	    threshold.
+//	hours roundTrips
+//	    The number of counterparties the identity both sent to and received
+//	    from in the last hours.
+//
+// For example, `10000 1000 24 structuringCount 3 >=` is true if the identity
+// sent three or more transfers between 9,000 and 10,000 in the last day.
+var structuringOperators = []Operator{opStructuringCount, opRoundTrips}
+
+var structuringOperatorNames = []string{opStructuringCount.Name, opRoundTrips.Name}
+
+var opStructuringCount = Operator{
+	Name:    "structuringCount",
+	Args:    []vm.Type{vm.NumberType, vm.NumberType, vm.NumberType},
+	Results: []vm.Type{vm.NumberType},
+	Fn: func(s vm.State) error {
+		args, err := popNumbers(s, 3)
+		if err != nil {
+			return err
+		}
+		threshold, margin := args[0], args[1]
+		h, since, err := historySince(s, args[2])
+		if err != nil {
+			return err
+		}
+
+		// Compare exactly, since amounts in base units can exceed the
+		// precision of a float
+		lo, hi := new(big.Float).SetFloat64(threshold-margin), new(big.Float).SetFloat64(threshold)
+		var n int
+		for _, t := range h.Transfers {
+			if t.Amount == nil || t.Time.Before(since) || !t.of(h.Token) {
+				continue
+			}
+			amount := new(big.Float).SetInt(t.Amount)
+			if amount.Cmp(lo) >= 0 && amount.Cmp(hi) < 0 {
+				n++
+			}
+		}
+		return s.Data().Push(must1(vm.AsValue(n)))
+	},
+}
+
+var opRoundTrips = Operator{
+	Name:    "roundTrips",
+	Args:    []vm.Type{vm.NumberType},
+	Results: []vm.Type{vm.NumberType},
+	Fn: func(s vm.State) error {
+		args, err := popNumbers(s, 1)
+		if err != nil {
+			return err
+		}
+		h, since, err := historySince(s, args[0])
+		if err != nil {
+			return err
+		}
+
+		sent := map[string]bool{}
+		for _, t := range h.Transfers {
+			if !t.Time.Before(since) {
+				sent[partyKey(t.Recipient)] = true
+			}
+		}
+		var n int
+		for _, t := range h.Incoming {
+			if k := partyKey(t.Sender); !t.Time.Before(since) && sent[k] {
+				sent[k] = false
+				n++
+			}
+		}
+		return s.Data().Push(must1(vm.AsValue(n)))
+	},
+}
+
+func popNumbers(s vm.State, n int) ([]float64, error) {
+	v, err := s.Data().Pop(n)
+	if err != nil {
+		return nil, err
+	}
+	f := make([]float64, n)
+	for i, v := range v {
+		f[i], err = vm.AsFloat(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// historySince returns the history of the request and the start of a window
+// that ends at the time of the request.
+func historySince(s vm.State, hours float64) (*History, time.Time, error) {
+	h, ok := s.Context().Value(historyKey{}).(*History)
+	if !ok {
+		return nil, time.Time{}, errors.New("the transfer history is not available")
+	}
+	window := time.Duration(hours * float64(time.Hour))
+	if window <= 0 || window > historyWindow {
+		return nil, time.Time{}, fmt.Errorf("invalid window of %v hours: must be positive and at most %v", hours, historyWindow)
+	}
+	return h, evaluationTime(s.Context()).Add(-window), nil
+}
+
+type historyKey struct{}
+
+// withHistory returns a context that makes the history available to the
+// structuring operators.
+func withHistory(ctx context.Context, h *History) context.Context {
+	return context.WithValue(ctx, historyKey{}, h)
+}
+
+// partyKey normalizes an ADI or an EVM address so the same party always has
+// the same key.
+func partyKey(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "acc://"))
+}
+
+// fetchIncoming returns the transfers the identity's counterparties sent to it
+// in the history window. Only counterparties that are ADIs have a chain of
+// commands.
+func fetchIncoming(ctx context.Context, client api.Querier, identity *url.URL, sent []*Transfer, asOf time.Time) ([]*Transfer, error) {
+	var incoming []*Transfer
+	seen := map[string]bool{}
+	for _, t := range sent {
+		k := partyKey(t.Recipient)
+		if seen[k] || common.IsHexAddress(t.Recipient) {
+			continue
+		}
+		seen[k] = true
+		counterparty, err := url.Parse(t.Recipient)
+		if err != nil {
+			continue
+		}
+
+		transfers, err := FetchTransfers(ctx, client, counterparty, asOf, historyWindow)
+		if err != nil {
+			return nil, fmt.Errorf("counterparty %v: %w", counterparty, err)
+		}
+		for _, u := range transfers {
+			if partyKey(u.Recipient) == partyKey(identity.String()) {
+				incoming = append(incoming, u)
+			}
+		}
+	}
+	return incoming, nil
+}
@@ -0,0 +1,99 @@
+package rules_test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+func TestStructuring(t *testing.T) {
+	q := newHistoryQuerier()
+	alice, bob := url.MustParse("alice.acme"), url.MustParse("bob.acme")
+	usdc := "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	transfer := func(block uint64, from, to *url.URL, amount string) {
+		q.write(from.JoinPath("discoveryV1ClientDefault_chainofcommands", "Command_V1"), block, must1(json.Marshal(map[string]any{
+			"segements": []any{map[string]any{"segmentType": "data", "config": map[string]any{"dataItems": []any{map[string]any{
+				"paramSenderAdiUrl":         from.String(),
+				"paramReceipientEvmAddress": to.String(),
+				"paramEvmTokenAddress":      usdc,
+				"paramAmount":               amount,
+			}}}}},
+		})))
+	}
+	q.writeCertificate(alice, 0, map[string]any{
+		"certificationStatus": "passed",
+		"dataOperationType":   "create",
+		"fromDate":            "2024-01-01",
+		"toDate":              "2030-01-01",
+	})
+
+	// Three transfers just below 10,000 in three hours, and most of it sent
+	// back a few hours later
+	transfer(100, alice, bob, "9500")
+	transfer(101, alice, bob, "9600")
+	transfer(102, alice, bob, "9900")
+	transfer(110, bob, alice, "9000")
+
+	// Deny three or more transfers within 10% of the threshold in a day, and
+	// review round trips within a week
+	rs := testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<attribute_fields><TYPE>ALL</TYPE></attribute_fields>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>10000 1000 24 structuringCount 3 &gt;=</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+<condition_details>
+<condition_number>2</condition_number>
+<condition_postfix>168 roundTrips 0 &gt;</condition_postfix>
+<condition_column column_number="2" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions>
+<action_details>
+<action_number>1</action_number>
+<action_postfix>true /denied xdef "STRUCTURING_SUSPECTED" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details>
+<action_details>
+<action_number>2</action_number>
+<action_postfix>"ROUND_TRIP_SUSPECTED" reviewReason swap addto</action_postfix>
+<action_column column_number="2" column_value="X"></action_column></action_details>
+</actions>
+</decision_table></decision_tables>`, "ruleset.json", `{"historyToken": "`+usdc+`"}`)
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+	execute := func(block uint64) *rules.Result {
+		t.Helper()
+		asOf := blockTime(block)
+		res, err := engine.Execute(context.Background(), q, &rules.Request{Identity: alice, AsOf: &asOf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	codes := func(reasons []*rules.Reason) []string {
+		var codes []string
+		for _, r := range reasons {
+			codes = append(codes, r.Code)
+		}
+		return codes
+	}
+
+	res := execute(112)
+	if !res.Denied || !slices.Equal(codes(res.Reasons), []string{"STRUCTURING_SUSPECTED"}) {
+		t.Fatalf("want denied for structuring, got %v", codes(res.Reasons))
+	}
+	if !slices.Equal(codes(res.ReviewReasons), []string{"ROUND_TRIP_SUSPECTED"}) {
+		t.Fatalf("want a round trip to review, got %v", codes(res.ReviewReasons))
+	}
+
+	// A day and a half later the transfers are outside the structuring window
+	// but the round trip is still reviewed
+	res = execute(150)
+	if res.Denied || len(res.ReviewReasons) != 1 || !slices.Equal(res.RecommendedActions, []string{rules.ActionManualReview}) {
+		t.Fatalf("want allowed with a manual review, got %+v", res)
+	}
+}
@@ -0,0 +1,275 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+
+	"github.com/C3Rules/Go-DTRules/pkg/vm"
+	"github.com/ethereum/go-ethereum/common"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/api/v3"
+	"gitlab.com/accumulatenetwork/accumulate/pkg/url"
+)
+
+// Transaction is a transfer to screen. The fields are named for the
+// parameters of the EvmTokenTransfer data item, so an item can be decoded as
+// a transaction.
+type Transaction struct {
+	Sender *url.URL `json:"paramSenderAdiUrl"`
+
+	// Recipient is an ADI or an EVM address.
+	Recipient string `json:"paramReceipientEvmAddress"`
+
+	// Token is the address of the token contract.
+	Token string `json:"paramEvmTokenAddress,omitempty"`
+
+	// Amount is an integer in the token's base units, for example 2500000
+	// for 2.5 of a token with six decimals.
+	Amount json.Number `json:"paramAmount"`
+	Memo   string      `json:"paramMemo,omitempty"`
+}
+
+// Parties of a transaction.
+const (
+	PartySender    = "sender"
+	PartyRecipient = "recipient"
+)
+
+// Recipient types.
+const (
+	RecipientADI = "adi"
+	RecipientEVM = "evm"
+)
+
+// PartyResult is the result of one of the parties of a transaction.
+type PartyResult struct {
+	Role  string `json:"role"`
+	Party string `json:"party"`
+
+	// Result is nil if the party has no certificates to evaluate, that is if
+	// it is an EVM address.
+	Result *Result `json:"result,omitempty"`
+}
+
+// transactionFields are the fields of the transaction entity, which is
+// available to the decision tables while screening a transaction. Party is
+// the role of the party whose certificate is being evaluated.
+var transactionFields = []string{"sender", "recipient", "recipientType", "token", "amount", "memo", "party"}
+
+// recipient returns the recipient's ADI, or nil if it is an EVM address.
+func (t *Transaction) recipient() (*url.URL, error) {
+	if common.IsHexAddress(t.Recipient) {
+		return nil, nil
+	}
+	u, err := url.Parse(t.Recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: want an ADI or an EVM address", t.Recipient)
+	}
+	return u, nil
+}
+
+// amount returns the amount of the transaction in the token's base units.
+func (t *Transaction) amount() (*big.Int, error) {
+	amount, err := parseAmount(t.Amount.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %w", t.Amount, err)
+	}
+	return amount, nil
+}
+
+// parseAmount parses an amount in a token's base units, which must be a
+// non-negative integer that fits in a uint256.
+func parseAmount(s string) (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(s, 10)
+	switch {
+	case !ok:
+		return nil, errors.New("want an integer in the token's base units")
+	case amount.Sign() < 0:
+		return nil, errors.New("must not be negative")
+	case amount.BitLen() > 256:
+		return nil, errors.New("must fit in a uint256")
+	}
+	return amount, nil
+}
+
+// baseUnits returns the amount as the tables see it. The VM compares numbers
+// as 64-bit integers, so an amount too large for one is seen as the largest
+// and still exceeds any limit a table can set.
+func baseUnits(amount *big.Int) int64 {
+	switch {
+	case amount == nil:
+		return 0
+	case amount.IsInt64():
+		return amount.Int64()
+	default:
+		return math.MaxInt64
+	}
+}
+
+func (t *Transaction) entity() (map[string]any, error) {
+	if t.Sender == nil {
+		return nil, errors.New("missing sender")
+	}
+	if t.Recipient == "" {
+		return nil, errors.New("missing recipient")
+	}
+	amount, err := t.amount()
+	if err != nil {
+		return nil, err
+	}
+
+	recipientType := RecipientADI
+	if common.IsHexAddress(t.Recipient) {
+		recipientType = RecipientEVM
+	}
+	return map[string]any{
+		"sender":        t.Sender.String(),
+		"recipient":     t.Recipient,
+		"recipientType": recipientType,
+		"token":         t.Token,
+		"amount":        baseUnits(amount),
+		"memo":          t.Memo,
+	}, nil
+}
+
+// screen fetches the certificates of the parties of the request's transaction
+// and screens it.
+func (e *Engine) screen(ctx context.Context, client api.Querier, rs *Ruleset, req *Request) (*Result, error) {
+	tx := req.Transaction
+	if tx.Sender == nil {
+		return nil, errors.New("missing sender")
+	}
+	if _, err := tx.amount(); err != nil {
+		return nil, err
+	}
+	sender, err := FetchAmlCerts(ctx, client, tx.Sender)
+	if err == nil {
+		err = fetchIssuers(ctx, client, rs, sender)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sender: %w", err)
+	}
+
+	recipientUrl, err := tx.recipient()
+	if err != nil {
+		return nil, err
+	}
+	var recipient []*IdentityCertificate
+	if recipientUrl != nil {
+		recipient, err = FetchAmlCerts(ctx, client, recipientUrl)
+		if err == nil {
+			err = fetchIssuers(ctx, client, rs, recipient)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recipient: %w", err)
+		}
+	}
+
+	return e.screenTransaction(ctx, client, rs, req, sender, recipient)
+}
+
+// EvaluateTransaction screens the request's transaction against certificates
+// that have already been fetched. If the recipient is an EVM address it has
+// no certificates. If the ruleset uses the transfer history, the request must
+// provide the sender's, and the recipient's is empty.
+func (e *Engine) EvaluateTransaction(ctx context.Context, req *Request, sender, recipient []*IdentityCertificate) (*Result, error) {
+	rs, err := e.Ruleset(req.Ruleset)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.screenTransaction(ctx, nil, rs, req, sender, recipient)
+	if err != nil {
+		return nil, err
+	}
+	return e.attest(rs, req, res)
+}
+
+// screenTransaction evaluates the certificates of each party with the
+// transaction entity and the party's history. The transaction is denied if
+// either party is denied.
+func (e *Engine) screenTransaction(ctx context.Context, client api.Querier, rs *Ruleset, req *Request, sender, recipient []*IdentityCertificate) (*Result, error) {
+	tx := req.Transaction
+	if tx == nil {
+		return nil, errors.New("missing transaction")
+	}
+	values, err := tx.entity()
+	if err != nil {
+		return nil, err
+	}
+	recipientUrl, err := tx.recipient()
+	if err != nil {
+		return nil, err
+	}
+	if len(sender) == 0 {
+		return nil, errors.New("sender: no certificates")
+	}
+	if recipientUrl == nil && len(recipient) > 0 {
+		return nil, errors.New("an EVM recipient cannot have certificates")
+	}
+	if recipientUrl != nil && len(recipient) == 0 {
+		return nil, errors.New("recipient: no certificates")
+	}
+	var evmAddress *EvmAddress
+	if recipientUrl == nil {
+		evmAddress, err = e.screenAddress(tx.Recipient)
+		if err != nil {
+			return nil, fmt.Errorf("recipient: %w", err)
+		}
+	}
+
+	// Both parties are evaluated as of the same time
+	req = e.withTime(req)
+	history := make([][]vm.Entity, 2)
+	history[0], err = e.history(ctx, client, rs, req, tx.Sender)
+	if err != nil {
+		return nil, fmt.Errorf("sender: %w", err)
+	}
+	if recipientUrl != nil {
+		r := *req
+		r.History = nil
+		if client == nil && rs.usesHistory() {
+			r.History = new(History)
+		}
+		history[1], err = e.history(ctx, client, rs, &r, recipientUrl)
+		if err != nil {
+			return nil, fmt.Errorf("recipient: %w", err)
+		}
+	}
+
+	parties := []*PartyResult{
+		{Role: PartySender, Party: tx.Sender.String()},
+		{Role: PartyRecipient, Party: tx.Recipient},
+	}
+	var results []*Result
+	for i, certs := range [][]*IdentityCertificate{sender, recipient} {
+		if len(certs) == 0 {
+			continue
+		}
+		// The entities are shared by every certificate of the party, so the
+		// tables may not modify them
+		values := maps.Clone(values)
+		values["party"] = parties[i].Role
+		transaction := readOnlyEntity{&jEntity{"transaction", values}}
+		res, err := e.evaluateCertificates(ctx, rs, req, certs, append(history[i], transaction, readOnlyEntity{evmAddress.entity()})...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", parties[i].Role, err)
+		}
+		parties[i].Result = res
+		results = append(results, res)
+	}
+
+	res := aggregate(AggregateAllValid, results)
+	res.Aggregation = ""
+	res.Certificates = nil
+	res.certificates = nil
+	for _, r := range results {
+		res.certificates = append(res.certificates, r.certificates...)
+	}
+	res.Parties = parties
+	res.EvmAddress = evmAddress
+	return res, nil
+}
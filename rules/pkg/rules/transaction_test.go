@@ -0,0 +1,130 @@
+package rules_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/rules"
+)
+
+func TestTransactionScreening(t *testing.T) {
+	// A table that denies expired certificates and otherwise checks that the
+	// sender does not transfer more than 10,000
+	rs := testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>toDate cvd getdate d&lt;</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column>
+<condition_column column_number="2" column_value="N"></condition_column></condition_details>
+</conditions>
+<actions>
+<action_details>
+<action_number>1</action_number>
+<action_postfix>true /denied xdef "Certificate has expired" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details>
+<action_details>
+<action_number>2</action_number>
+<action_postfix>Check_Amount</action_postfix>
+<action_column column_number="2" column_value="X"></action_column></action_details>
+</actions>
+</decision_table>
+<decision_table>
+<table_name>Check_Amount</table_name>
+<conditions>
+<condition_details>
+<condition_number>1</condition_number>
+<condition_postfix>party "sender" s== amount 10000 &gt; &amp;&amp;</condition_postfix>
+<condition_column column_number="1" column_value="Y"></condition_column></condition_details>
+</conditions>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>true /denied xdef "Amount exceeds the limit" denialReason swap addto</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`)
+	engine := rules.NewEngine(must1(rules.NewRegistry(rs)))
+
+	// A transfer is decoded from the parameters of an EvmTokenTransfer item
+	decode := func(item string) *rules.Transaction {
+		t.Helper()
+		tx := new(rules.Transaction)
+		err := json.Unmarshal([]byte(item), tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	newCert := func(toDate string) []*rules.IdentityCertificate {
+		return []*rules.IdentityCertificate{{Target: "primaryAml", Data: map[string]any{
+			"certificationStatus": "passed",
+			"dataOperationType":   "create",
+			"fromDate":            "2024-01-01",
+			"toDate":              toDate,
+		}}}
+	}
+	valid, expired := newCert("2030-01-01"), newCert("2024-03-01")
+	asOf := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		item      string
+		recipient []*rules.IdentityCertificate
+		reasons   []string
+	}{
+		{"allowed", `{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "bob.acme", "paramAmount": "2500"}`, valid, nil},
+		{"over the limit", `{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "bob.acme", "paramAmount": "25000"}`, valid, []string{"Amount exceeds the limit"}},
+		{"too large for the tables", `{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "bob.acme", "paramAmount": "100000000000000000000"}`, valid, []string{"Amount exceeds the limit"}},
+		{"expired recipient", `{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "bob.acme", "paramAmount": "2500"}`, expired, []string{"Certificate has expired"}},
+		{"EVM recipient", `{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "0x742d35Cc6634C0532925a3b844Bc454e4438f44e", "paramAmount": "2500", "paramEvmTokenAddress": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}`, nil, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := engine.EvaluateTransaction(context.Background(), &rules.Request{Transaction: decode(c.item), AsOf: &asOf}, valid, c.recipient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Denied != (c.reasons != nil) || len(res.Parties) != 2 {
+				t.Fatalf("want denied=%v for both parties, got %+v", c.reasons != nil, res)
+			}
+			for i, reason := range c.reasons {
+				if res.DenialReason.([]any)[i] != reason {
+					t.Fatalf("want %q, got %v", c.reasons, res.DenialReason)
+				}
+			}
+			if (res.Parties[1].Result == nil) != (c.recipient == nil) {
+				t.Fatalf("want the recipient evaluated only if it is an ADI, got %+v", res.Parties[1])
+			}
+		})
+	}
+
+	_, err := engine.EvaluateTransaction(context.Background(), &rules.Request{Transaction: decode(`{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "bob.acme", "paramAmount": "-1"}`)}, valid, valid)
+	if err == nil {
+		t.Fatal("want an error for a negative amount")
+	}
+
+	// The transaction is shared by both parties and every certificate, so the
+	// tables cannot modify it
+	rs = testRuleset(t, `<decision_tables><decision_table>
+<table_name>Validate_Certificate</table_name>
+<actions><action_details>
+<action_number>1</action_number>
+<action_postfix>0 /amount xdef</action_postfix>
+<action_column column_number="1" column_value="X"></action_column></action_details></actions>
+</decision_table></decision_tables>`)
+	_, err = rules.NewEngine(must1(rules.NewRegistry(rs))).EvaluateTransaction(context.Background(), &rules.Request{Transaction: decode(`{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "bob.acme", "paramAmount": "2500"}`), AsOf: &asOf}, valid, valid)
+	if err == nil || !strings.Contains(err.Error(), "amount is read-only") {
+		t.Fatalf("want the transaction to be read-only, got %v", err)
+	}
+
+	// Amounts are integers in base units, and are checked before the
+	// certificates are fetched
+	_, err = engine.Execute(context.Background(), newHistoryQuerier(), &rules.Request{Transaction: decode(`{"paramSenderAdiUrl": "alice.acme", "paramReceipientEvmAddress": "bob.acme", "paramAmount": "1.5"}`)})
+	if err == nil || !strings.Contains(err.Error(), "base units") {
+		t.Fatalf("want an invalid amount, got %v", err)
+	}
+}
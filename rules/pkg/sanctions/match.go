@@ -0,0 +1,244 @@
+package sanctions
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// List is a set of entries indexed for screening.
+type List struct {
+	Entries []*Entry
+
+	names     []*indexedName
+	trigrams  map[string][]int
+	addresses map[string][]*Entry
+}
+
+type indexedName struct {
+	entry  *Entry
+	name   string
+	tokens []string
+}
+
+// Hit is an entry that matches a screened name.
+type Hit struct {
+	Entry *Entry `json:"entry"`
+
+	// Query is the screened name and Matched is the name or alias of the
+	// entry it matched.
+	Query   string `json:"query"`
+	Matched string `json:"matched"`
+
+	// Score is between 0 and 1, where 1 is an exact match after
+	// normalization.
+	Score float64 `json:"score"`
+}
+
+// NewList indexes the names and aliases of the entries.
+func NewList(entries []*Entry) *List {
+	l := &List{Entries: entries, trigrams: map[string][]int{}, addresses: map[string][]*Entry{}}
+	for _, e := range entries {
+		for _, a := range e.Addresses {
+			k := strings.ToLower(a)
+			l.addresses[k] = append(l.addresses[k], e)
+		}
+		for _, name := range e.Names() {
+			tokens := Normalize(name)
+			if len(tokens) == 0 {
+				continue
+			}
+			i := len(l.names)
+			l.names = append(l.names, &indexedName{e, name, tokens})
+			for _, t := range trigrams(tokens) {
+				l.trigrams[t] = append(l.trigrams[t], i)
+			}
+		}
+	}
+	return l
+}
+
+// Search returns the entries with a name or alias that matches the name with
+// at least the minimum score, the best first. Each entry is returned once,
+// for its best matching name.
+//
+// Names are normalized by transliterating Cyrillic, removing diacritics, case,
+// and punctuation. Then each token of the name is paired with its most similar
+// token of the candidate, so the order of the tokens does not matter, and the
+// similarity of two tokens is based on their edit distance. Tokens without a
+// pair count as a mismatch.
+func (l *List) Search(name string, minScore float64) []*Hit {
+	query := Normalize(name)
+	if len(query) == 0 {
+		return nil
+	}
+
+	// Only score names that share enough trigrams with the query
+	grams := trigrams(query)
+	shared := map[int]int{}
+	for _, t := range grams {
+		for _, i := range l.trigrams[t] {
+			shared[i]++
+		}
+	}
+
+	best := map[*Entry]*Hit{}
+	for i, n := range shared {
+		if float64(n) < float64(len(grams))*minShared {
+			continue
+		}
+		c := l.names[i]
+		score := Score(query, c.tokens)
+		if score < minScore {
+			continue
+		}
+		if h, ok := best[c.entry]; !ok || score > h.Score {
+			best[c.entry] = &Hit{Entry: c.entry, Query: name, Matched: c.name, Score: score}
+		}
+	}
+
+	hits := make([]*Hit, 0, len(best))
+	for _, h := range best {
+		hits = append(hits, h)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Entry.ID < hits[j].Entry.ID
+	})
+	return hits
+}
+
+// SearchAddress returns the entries with the digital currency address. The
+// case of the address is ignored.
+func (l *List) SearchAddress(addr string) []*Entry {
+	return l.addresses[strings.ToLower(strings.TrimSpace(addr))]
+}
+
+// minShared is the fraction of the query's trigrams a name must share to be
+// scored.
+const minShared = 0.3
+
+// Score returns the similarity of two normalized names, between 0 and 1.
+func Score(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	// Pair the most similar tokens first
+	type pair struct {
+		i, j int
+		sim  float64
+	}
+	var pairs []pair
+	for i, x := range a {
+		for j, y := range b {
+			pairs = append(pairs, pair{i, j, similarity(x, y)})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].sim > pairs[j].sim })
+	usedA, usedB := make([]bool, len(a)), make([]bool, len(b))
+	var total float64
+	for _, p := range pairs {
+		if usedA[p.i] || usedB[p.j] {
+			continue
+		}
+		usedA[p.i], usedB[p.j] = true, true
+		total += p.sim
+	}
+	score := total / float64(max(len(a), len(b)))
+
+	// Names that are split differently, such as "Al Qaida" and "Alqaida"
+	return max(score, similarity(strings.Join(a, ""), strings.Join(b, "")))
+}
+
+// similarity is one minus the edit distance of the strings relative to the
+// length of the longer one.
+func similarity(a, b string) float64 {
+	x, y := []rune(a), []rune(b)
+	n := max(len(x), len(y))
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(x, y))/float64(n)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func trigrams(tokens []string) []string {
+	var grams []string
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		r := []rune("$" + t + "$")
+		for i := 0; i+3 <= len(r); i++ {
+			g := string(r[i : i+3])
+			if !seen[g] {
+				seen[g] = true
+				grams = append(grams, g)
+			}
+		}
+	}
+	return grams
+}
+
+// Normalize transliterates the name to lowercase ASCII letters and digits and
+// splits it into tokens.
+func Normalize(name string) []string {
+	// Transliterate composed letters, so й is not decomposed to и
+	var t strings.Builder
+	for _, r := range norm.NFC.String(strings.ToLower(name)) {
+		if s, ok := transliteration[r]; ok {
+			t.WriteString(s)
+		} else {
+			t.WriteRune(r)
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(t.String()) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Drop diacritics
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case r == '\'' || r == '’' || r == '`':
+			// Drop apostrophes so "O'Neil" is one token
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+// transliteration maps letters that do not decompose to ASCII, including
+// Cyrillic, to Latin.
+var transliteration = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'ł': "l", 'þ': "th", 'ı': "i",
+
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+	'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y",
+	'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'ё': "e", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
@@ -0,0 +1,270 @@
+// Package sanctions loads sanctions lists from local files and screens names
+// against them. Lists can be read in the OFAC SDN XML and CSV formats and in a
+// simple JSON format. Names and aliases are matched fuzzily, see [List.Search].
+package sanctions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Entry is a sanctioned party.
+type Entry struct {
+	ID       string   `json:"id"`
+	Source   string   `json:"source,omitempty"`
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Programs []string `json:"programs,omitempty"`
+
+	// Addresses are the digital currency addresses of the party, such as EVM
+	// addresses.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Names returns the name and the aliases of the entry.
+func (e *Entry) Names() []string {
+	return append([]string{e.Name}, e.Aliases...)
+}
+
+// LoadDir loads every list in the directory. Files are read according to
+// their extension: .xml as OFAC SDN XML, .csv as OFAC SDN CSV, and .json as
+// the JSON format. The aliases of a CSV list are read from alt.csv, which
+// must be next to it.
+func LoadDir(dir string) (*List, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, f := range files {
+		if f.IsDir() || strings.EqualFold(f.Name(), altFile) {
+			continue
+		}
+		file := filepath.Join(dir, f.Name())
+		var e []*Entry
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".xml":
+			e, err = loadFile(file, ReadSDNXML)
+		case ".csv":
+			e, err = loadFile(file, ReadSDNCSV)
+			if err == nil {
+				err = loadAliases(filepath.Join(dir, altFile), e)
+			}
+		case ".json":
+			e, err = loadFile(file, ReadJSON)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		source := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		for _, e := range e {
+			if e.Source == "" {
+				e.Source = source
+			}
+		}
+		entries = append(entries, e...)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no sanctions lists found")
+	}
+	return NewList(entries), nil
+}
+
+func loadFile(file string, read func(io.Reader) ([]*Entry, error)) ([]*Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+// ReadJSON reads a list in the JSON format, which is an array of entries or an
+// object with a source and an array of entries:
+//
+//	{"source": "internal", "entries": [{"id": "1", "name": "John Doe", "aliases": ["Johnny Doe"]}]}
+func ReadJSON(r io.Reader) ([]*Entry, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Source  string   `json:"source"`
+		Entries []*Entry `json:"entries"`
+	}
+	if len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &list.Entries)
+	} else {
+		err = json.Unmarshal(b, &list)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range list.Entries {
+		if e.Name == "" {
+			return nil, fmt.Errorf("entry %d has no name", i+1)
+		}
+		if e.Source == "" {
+			e.Source = list.Source
+		}
+	}
+	return list.Entries, nil
+}
+
+// ReadSDNXML reads a list in the OFAC SDN XML format.
+func ReadSDNXML(r io.Reader) ([]*Entry, error) {
+	type name struct {
+		FirstName string `xml:"firstName"`
+		LastName  string `xml:"lastName"`
+	}
+	var doc struct {
+		Entries []struct {
+			UID string `xml:"uid"`
+			name
+			Type     string   `xml:"sdnType"`
+			Programs []string `xml:"programList>program"`
+			Akas     []name   `xml:"akaList>aka"`
+			IDs      []struct {
+				Type   string `xml:"idType"`
+				Number string `xml:"idNumber"`
+			} `xml:"idList>id"`
+		} `xml:"sdnEntry"`
+	}
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	full := func(n name) string {
+		return strings.TrimSpace(n.FirstName + " " + n.LastName)
+	}
+	var entries []*Entry
+	for _, x := range doc.Entries {
+		e := &Entry{ID: x.UID, Name: full(x.name), Type: x.Type, Programs: x.Programs}
+		for _, aka := range x.Akas {
+			e.Aliases = append(e.Aliases, full(aka))
+		}
+		for _, id := range x.IDs {
+			if strings.HasPrefix(id.Type, digitalCurrencyAddress) {
+				e.Addresses = append(e.Addresses, id.Number)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// digitalCurrencyAddress prefixes the ID type of a digital currency address,
+// such as "Digital Currency Address - ETH".
+const digitalCurrencyAddress = "Digital Currency Address"
+
+var reAddressRemark = regexp.MustCompile(digitalCurrencyAddress + ` - \w+ ([0-9A-Za-z]+)`)
+
+// altFile is the file the aliases of an SDN CSV list are read from.
+const altFile = "alt.csv"
+
+// ReadSDNCSV reads a list in the OFAC SDN CSV format (sdn.csv). The columns
+// are the entry number, name, type, programs, title, call sign, vessel type,
+// tonnage, gross tonnage, vessel flag, vessel owner, and remarks. Digital
+// currency addresses are read from the remarks.
+func ReadSDNCSV(r io.Reader) ([]*Entry, error) {
+	records, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, rec := range records {
+		if len(rec) < 4 || rec[1] == "" {
+			continue
+		}
+		e := &Entry{ID: rec[0], Name: sdnName(rec[1]), Type: rec[2]}
+		for _, p := range strings.Split(rec[3], "] [") {
+			if p := strings.Trim(p, "[] "); p != "" {
+				e.Programs = append(e.Programs, p)
+			}
+		}
+		if len(rec) > 11 {
+			for _, m := range reAddressRemark.FindAllStringSubmatch(rec[11], -1) {
+				e.Addresses = append(e.Addresses, m[1])
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// loadAliases adds the aliases in an SDN alt.csv file to the entries. The
+// columns are the entry number, alias number, type, name, and remarks. A
+// missing file is ignored.
+func loadAliases(file string, entries []*Entry) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := readCSV(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", altFile, err)
+	}
+	byID := map[string]*Entry{}
+	for _, e := range entries {
+		byID[e.ID] = e
+	}
+	for _, rec := range records {
+		if len(rec) < 4 {
+			continue
+		}
+		if e, ok := byID[rec[0]]; ok && rec[3] != "" {
+			e.Aliases = append(e.Aliases, sdnName(rec[3]))
+		}
+	}
+	return nil
+}
+
+// readCSV reads the records of an OFAC CSV file, in which a null value is
+// written as -0-.
+func readCSV(r io.Reader) ([][]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		for i, v := range rec {
+			v = strings.TrimSpace(v)
+			if v == "-0-" {
+				v = ""
+			}
+			rec[i] = v
+		}
+	}
+	return records, nil
+}
+
+// sdnName converts a name written as "LAST, First" to "First LAST".
+func sdnName(s string) string {
+	last, first, ok := strings.Cut(s, ", ")
+	if !ok {
+		return s
+	}
+	return strings.TrimSpace(first) + " " + strings.TrimSpace(last)
+}
@@ -0,0 +1,88 @@
+package sanctions_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/sanctions"
+)
+
+func TestLoadDir(t *testing.T) {
+	l, err := sanctions.LoadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[string]*sanctions.Entry{}
+	for _, e := range l.Entries {
+		byID[e.ID] = e
+	}
+	if len(byID) != 5 {
+		t.Fatalf("want 5 entries, got %d", len(byID))
+	}
+
+	ivanov := byID["1001"]
+	if ivanov.Name != "Vladimir IVANOV" || ivanov.Source != "sdn" || !slices.Equal(ivanov.Aliases, []string{"Владимир ИВАНОВ"}) {
+		t.Fatalf("unexpected XML entry %+v", ivanov)
+	}
+	if !slices.Equal(ivanov.Addresses, []string{"0x8589427373D6D84E98730D7795D8f6f8731FDA16"}) {
+		t.Fatalf("unexpected XML addresses %v", ivanov.Addresses)
+	}
+
+	muller := byID["4001"]
+	if muller.Name != "José MÜLLER" || !slices.Equal(muller.Aliases, []string{"Jose MUELLER"}) || !slices.Equal(muller.Programs, []string{"SDGT", "IRGC"}) {
+		t.Fatalf("unexpected CSV entry %+v", muller)
+	}
+	if !slices.Equal(muller.Addresses, []string{"1FfmbHfnpaZjKFvyi1okTjJJusN455paPH", "0x098B716B8Aaf21512996dC57EB0615e2383E2f96"}) {
+		t.Fatalf("unexpected CSV addresses %v", muller.Addresses)
+	}
+	if byID["36"].Type != "" {
+		t.Fatalf("want a null type, got %q", byID["36"].Type)
+	}
+
+	if byID["X-1"].Source != "internal" {
+		t.Fatalf("want the source of the JSON list, got %q", byID["X-1"].Source)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	l, err := sanctions.LoadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name, query, want string
+		minScore          float64
+	}{
+		{"exact", "Vladimir Ivanov", "1001", 1},
+		{"reordered", "IVANOV, Vladimir", "1001", 1},
+		{"transliterated", "Владимир Иванов", "1001", 1},
+		{"typo", "Vladimir Ivanof", "1001", 0.9},
+		{"diacritics", "Jose Muller", "4001", 1},
+		{"split", "Alqaida", "1002", 0.9},
+		{"apostrophe", "sean o'brien", "X-1", 1},
+		{"alias", "Aero Caribbean", "36", 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hits := l.Search(c.query, 0.85)
+			if len(hits) == 0 {
+				t.Fatalf("want a hit for %q", c.query)
+			}
+			if hits[0].Entry.ID != c.want || hits[0].Score < c.minScore {
+				t.Fatalf("want %s with a score of at least %v, got %s with %v", c.want, c.minScore, hits[0].Entry.ID, hits[0].Score)
+			}
+		})
+	}
+
+	if e := l.SearchAddress("0x8589427373d6d84e98730d7795d8f6f8731fda16"); len(e) != 1 || e[0].ID != "1001" {
+		t.Fatalf("want the entry of the address, got %v", e)
+	}
+
+	if hits := l.Search("Maria Garcia", 0.85); len(hits) != 0 {
+		t.Fatalf("want no hits, got %s with %v", hits[0].Entry.ID, hits[0].Score)
+	}
+	if hits := l.Search("Vladimir Petrov", 0.85); len(hits) != 0 {
+		t.Fatalf("want no hits for a partial match, got %v", hits[0].Score)
+	}
+}
@@ -0,0 +1,213 @@
+package xls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Compound File Binary (OLE2) containers, see [MS-CFB].
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	sectFree       = 0xFFFFFFFF
+	sectEndOfChain = 0xFFFFFFFE
+	sectFat        = 0xFFFFFFFD
+	sectDif        = 0xFFFFFFFC
+
+	dirStream = 2
+	dirRoot   = 5
+)
+
+type cfb struct {
+	data       []byte
+	sectorSize int
+	miniSize   int
+	miniCutoff uint64
+	fat        []uint32
+	miniFat    []uint32
+	miniStream []byte
+	entries    []cfbEntry
+}
+
+type cfbEntry struct {
+	name  string
+	typ   byte
+	start uint32
+	size  uint64
+}
+
+func openCFB(data []byte) (*cfb, error) {
+	if len(data) < 512 || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, errors.New("not a compound file")
+	}
+
+	le := binary.LittleEndian
+	f := &cfb{data: data}
+	major := le.Uint16(data[0x1A:])
+	f.sectorSize = 1 << le.Uint16(data[0x1E:])
+	f.miniSize = 1 << le.Uint16(data[0x20:])
+	f.miniCutoff = uint64(le.Uint32(data[0x38:]))
+	if f.sectorSize != 512 && f.sectorSize != 4096 {
+		return nil, fmt.Errorf("invalid sector size %d", f.sectorSize)
+	}
+
+	// Collect the FAT sectors listed in the header and the DIFAT chain
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		s := le.Uint32(data[0x4C+4*i:])
+		if s == sectFree || s == sectEndOfChain {
+			break
+		}
+		fatSectors = append(fatSectors, s)
+	}
+	dif, ndif := le.Uint32(data[0x44:]), le.Uint32(data[0x48:])
+	for i := uint32(0); i < ndif && dif != sectEndOfChain && dif != sectFree; i++ {
+		b, err := f.sector(dif)
+		if err != nil {
+			return nil, fmt.Errorf("read DIFAT: %w", err)
+		}
+		n := len(b)/4 - 1
+		for j := 0; j < n; j++ {
+			s := le.Uint32(b[4*j:])
+			if s == sectFree || s == sectEndOfChain {
+				continue
+			}
+			fatSectors = append(fatSectors, s)
+		}
+		dif = le.Uint32(b[4*n:])
+	}
+	for _, s := range fatSectors {
+		b, err := f.sector(s)
+		if err != nil {
+			return nil, fmt.Errorf("read FAT: %w", err)
+		}
+		for j := 0; j < len(b); j += 4 {
+			f.fat = append(f.fat, le.Uint32(b[j:]))
+		}
+	}
+
+	// Read the directory
+	dir, err := f.chain(le.Uint32(data[0x30:]), f.fat, f.sector)
+	if err != nil {
+		return nil, fmt.Errorf("read directory: %w", err)
+	}
+	for i := 0; i+128 <= len(dir); i += 128 {
+		b := dir[i : i+128]
+		n := int(le.Uint16(b[0x40:]))
+		if n > 64 {
+			n = 64
+		}
+		u := make([]uint16, 0, n/2)
+		for j := 0; j+1 < n; j += 2 {
+			if c := le.Uint16(b[j:]); c != 0 {
+				u = append(u, c)
+			}
+		}
+		size := le.Uint64(b[0x78:])
+		if major == 3 {
+			size &= 0xFFFFFFFF
+		}
+		f.entries = append(f.entries, cfbEntry{
+			name:  string(utf16.Decode(u)),
+			typ:   b[0x42],
+			start: le.Uint32(b[0x74:]),
+			size:  size,
+		})
+	}
+	if len(f.entries) == 0 || f.entries[0].typ != dirRoot {
+		return nil, errors.New("missing root directory entry")
+	}
+
+	// Read the mini FAT and the mini stream, which is stored in the root
+	// entry
+	miniFat, err := f.chain(le.Uint32(data[0x3C:]), f.fat, f.sector)
+	if err != nil {
+		return nil, fmt.Errorf("read mini FAT: %w", err)
+	}
+	for j := 0; j+4 <= len(miniFat); j += 4 {
+		f.miniFat = append(f.miniFat, le.Uint32(miniFat[j:]))
+	}
+	root := f.entries[0]
+	f.miniStream, err = f.chain(root.start, f.fat, f.sector)
+	if err != nil {
+		return nil, fmt.Errorf("read mini stream: %w", err)
+	}
+	if uint64(len(f.miniStream)) > root.size {
+		f.miniStream = f.miniStream[:root.size]
+	}
+	return f, nil
+}
+
+// stream returns the contents of the named stream, ignoring case.
+func (f *cfb) stream(name string) ([]byte, bool, error) {
+	for _, e := range f.entries {
+		if e.typ != dirStream || !strings.EqualFold(e.name, name) {
+			continue
+		}
+
+		var b []byte
+		var err error
+		if e.size < f.miniCutoff {
+			b, err = f.chain(e.start, f.miniFat, f.miniSector)
+		} else {
+			b, err = f.chain(e.start, f.fat, f.sector)
+		}
+		if err != nil {
+			return nil, true, fmt.Errorf("read %s: %w", e.name, err)
+		}
+		if uint64(len(b)) < e.size {
+			return nil, true, fmt.Errorf("read %s: stream is truncated", e.name)
+		}
+		return b[:e.size], true, nil
+	}
+	return nil, false, nil
+}
+
+func (f *cfb) sector(i uint32) ([]byte, error) {
+	off := (int(i) + 1) * f.sectorSize
+	if i >= sectDif || off < 0 || off >= len(f.data) {
+		return nil, fmt.Errorf("sector %d is out of range", i)
+	}
+	end := off + f.sectorSize
+	if end > len(f.data) {
+		// Tolerate a truncated final sector
+		end = len(f.data)
+	}
+	return f.data[off:end], nil
+}
+
+func (f *cfb) miniSector(i uint32) ([]byte, error) {
+	off := int(i) * f.miniSize
+	if i >= sectDif || off < 0 || off+f.miniSize > len(f.miniStream) {
+		return nil, fmt.Errorf("mini sector %d is out of range", i)
+	}
+	return f.miniStream[off : off+f.miniSize], nil
+}
+
+// chain concatenates the sectors of a chain. It fails if the chain loops.
+func (f *cfb) chain(start uint32, fat []uint32, read func(uint32) ([]byte, error)) ([]byte, error) {
+	var out []byte
+	for s, n := start, 0; s != sectEndOfChain; n++ {
+		if s == sectFree {
+			break
+		}
+		if n > len(fat) {
+			return nil, errors.New("sector chain loops")
+		}
+		b, err := read(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+		if int(s) >= len(fat) {
+			return nil, fmt.Errorf("sector %d is not in the allocation table", s)
+		}
+		s = fat[s]
+	}
+	return out, nil
+}
@@ -0,0 +1,513 @@
+// Package xls reads the cell values of legacy Excel (BIFF8, .xls) workbooks.
+// Formatting, formulas, and everything else that is not a cell value are
+// ignored. Formula cells are read as their cached result.
+package xls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Workbook is the cell values of an Excel workbook.
+type Workbook struct {
+	Sheets []*Sheet
+}
+
+// Sheet is a worksheet. Rows are indexed by row, then column, starting at
+// zero. Empty cells are empty strings; trailing empty cells are omitted.
+type Sheet struct {
+	Name string
+	Rows [][]string
+}
+
+// Sheet returns the named sheet.
+func (w *Workbook) Sheet(name string) (*Sheet, bool) {
+	for _, s := range w.Sheets {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Cell returns the value of a cell, or the empty string if it is empty.
+func (s *Sheet) Cell(row, col int) string {
+	if row < 0 || row >= len(s.Rows) || col < 0 || col >= len(s.Rows[row]) {
+		return ""
+	}
+	return s.Rows[row][col]
+}
+
+func (s *Sheet) set(row, col int, value string) {
+	for len(s.Rows) <= row {
+		s.Rows = append(s.Rows, nil)
+	}
+	for len(s.Rows[row]) <= col {
+		s.Rows[row] = append(s.Rows[row], "")
+	}
+	s.Rows[row][col] = value
+}
+
+// Open reads the workbook file.
+func Open(name string) (*Workbook, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Read reads a workbook.
+func Read(r io.Reader) (*Workbook, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses a workbook.
+func Parse(data []byte) (*Workbook, error) {
+	f, err := openCFB(data)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok, err := f.stream("Workbook")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if _, ok, _ := f.stream("Book"); ok {
+			return nil, errors.New("unsupported workbook: only Excel 97 and later (BIFF8) is supported")
+		}
+		return nil, errors.New("not a workbook")
+	}
+	return parseWorkbook(stream)
+}
+
+// Record types, see [MS-XLS].
+const (
+	recFormula    = 0x0006
+	recEOF        = 0x000A
+	recFilePass   = 0x002F
+	recContinue   = 0x003C
+	recBoundSheet = 0x0085
+	recMulRK      = 0x00BD
+	recRString    = 0x00D6
+	recSST        = 0x00FC
+	recLabelSST   = 0x00FD
+	recNumber     = 0x0203
+	recLabel      = 0x0204
+	recBoolErr    = 0x0205
+	recString     = 0x0207
+	recRK         = 0x027E
+	recBOF        = 0x0809
+)
+
+type record struct {
+	typ  uint16
+	data []byte
+
+	// continues holds the data of the CONTINUE records that follow
+	continues [][]byte
+}
+
+func readRecords(b []byte, off int) ([]*record, error) {
+	var records []*record
+	for off+4 <= len(b) {
+		typ := binary.LittleEndian.Uint16(b[off:])
+		n := int(binary.LittleEndian.Uint16(b[off+2:]))
+		off += 4
+		if off+n > len(b) {
+			return nil, fmt.Errorf("record %#04x is truncated", typ)
+		}
+		data := b[off : off+n]
+		off += n
+
+		if typ == recContinue && len(records) > 0 {
+			r := records[len(records)-1]
+			r.continues = append(r.continues, data)
+			continue
+		}
+		records = append(records, &record{typ: typ, data: data})
+		if typ == recEOF {
+			break
+		}
+	}
+	return records, nil
+}
+
+func parseWorkbook(stream []byte) (*Workbook, error) {
+	globals, err := readRecords(stream, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(globals) == 0 || globals[0].typ != recBOF || len(globals[0].data) < 2 {
+		return nil, errors.New("missing BOF record")
+	}
+	if v := binary.LittleEndian.Uint16(globals[0].data); v != 0x0600 {
+		return nil, fmt.Errorf("unsupported BIFF version %#04x: only Excel 97 and later (BIFF8) is supported", v)
+	}
+
+	type sheetRef struct {
+		name string
+		off  int
+	}
+	var refs []sheetRef
+	var sst []string
+	for _, r := range globals {
+		switch r.typ {
+		case recFilePass:
+			return nil, errors.New("workbook is encrypted")
+
+		case recBoundSheet:
+			if len(r.data) < 8 {
+				return nil, errors.New("invalid BOUNDSHEET record")
+			}
+			// Skip chart, macro, and VB module sheets
+			if r.data[5] != 0 {
+				continue
+			}
+			c := &cursor{segs: [][]byte{r.data[6:]}}
+			n, err := c.u8()
+			if err != nil {
+				return nil, err
+			}
+			name, err := c.chars(int(n))
+			if err != nil {
+				return nil, fmt.Errorf("invalid sheet name: %w", err)
+			}
+			refs = append(refs, sheetRef{name, int(binary.LittleEndian.Uint32(r.data))})
+
+		case recSST:
+			sst, err = parseSST(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid shared string table: %w", err)
+			}
+		}
+	}
+
+	w := new(Workbook)
+	for _, ref := range refs {
+		if ref.off < 0 || ref.off >= len(stream) {
+			return nil, fmt.Errorf("sheet %s: invalid offset", ref.name)
+		}
+		records, err := readRecords(stream, ref.off)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", ref.name, err)
+		}
+		sheet, err := parseSheet(ref.name, records, sst)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", ref.name, err)
+		}
+		w.Sheets = append(w.Sheets, sheet)
+	}
+	return w, nil
+}
+
+func parseSST(r *record) ([]string, error) {
+	c := &cursor{segs: append([][]byte{r.data}, r.continues...)}
+	if err := c.skip(4); err != nil {
+		return nil, err
+	}
+	n, err := c.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, 0, min(n, 1<<16))
+	for i := uint32(0); i < n; i++ {
+		s, err := c.unicodeString()
+		if err != nil {
+			return nil, fmt.Errorf("string %d: %w", i, err)
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+func parseSheet(name string, records []*record, sst []string) (*Sheet, error) {
+	s := &Sheet{Name: name}
+	le := binary.LittleEndian
+	var formula struct{ row, col int }
+	for _, r := range records[1:] {
+		d := r.data
+		if r.typ != recEOF && r.typ != recString && len(d) < 6 {
+			continue
+		}
+		row, col := 0, 0
+		if len(d) >= 4 {
+			row, col = int(le.Uint16(d)), int(le.Uint16(d[2:]))
+		}
+
+		switch r.typ {
+		case recLabelSST:
+			if len(d) < 10 {
+				return nil, errors.New("invalid LABELSST record")
+			}
+			i := int(le.Uint32(d[6:]))
+			if i >= len(sst) {
+				return nil, fmt.Errorf("cell %s refers to missing shared string %d", cellName(row, col), i)
+			}
+			s.set(row, col, sst[i])
+
+		case recLabel, recRString:
+			c := &cursor{segs: append([][]byte{d[6:]}, r.continues...)}
+			v, err := c.xlString()
+			if err != nil {
+				return nil, fmt.Errorf("cell %s: %w", cellName(row, col), err)
+			}
+			s.set(row, col, v)
+
+		case recNumber:
+			if len(d) < 14 {
+				return nil, errors.New("invalid NUMBER record")
+			}
+			s.set(row, col, formatNumber(math.Float64frombits(le.Uint64(d[6:]))))
+
+		case recRK:
+			if len(d) < 10 {
+				return nil, errors.New("invalid RK record")
+			}
+			s.set(row, col, formatNumber(decodeRK(le.Uint32(d[6:]))))
+
+		case recMulRK:
+			for i, off := 0, 4; off+6 <= len(d)-2; i, off = i+1, off+6 {
+				s.set(row, col+i, formatNumber(decodeRK(le.Uint32(d[off+2:]))))
+			}
+
+		case recBoolErr:
+			if len(d) < 8 {
+				return nil, errors.New("invalid BOOLERR record")
+			}
+			switch {
+			case d[7] != 0:
+				s.set(row, col, "#ERROR")
+			case d[6] != 0:
+				s.set(row, col, "TRUE")
+			default:
+				s.set(row, col, "FALSE")
+			}
+
+		case recFormula:
+			if len(d) < 14 {
+				return nil, errors.New("invalid FORMULA record")
+			}
+			v := d[6:14]
+			if le.Uint16(v[6:]) != 0xFFFF {
+				s.set(row, col, formatNumber(math.Float64frombits(le.Uint64(v))))
+				continue
+			}
+			switch v[0] {
+			case 0: // The value is in the following STRING record
+				formula.row, formula.col = row, col
+			case 1:
+				if v[2] != 0 {
+					s.set(row, col, "TRUE")
+				} else {
+					s.set(row, col, "FALSE")
+				}
+			case 2:
+				s.set(row, col, "#ERROR")
+			}
+
+		case recString:
+			c := &cursor{segs: append([][]byte{d}, r.continues...)}
+			v, err := c.xlString()
+			if err != nil {
+				return nil, fmt.Errorf("cell %s: %w", cellName(formula.row, formula.col), err)
+			}
+			s.set(formula.row, formula.col, v)
+		}
+	}
+	return s, nil
+}
+
+func decodeRK(rk uint32) float64 {
+	var v float64
+	if rk&2 != 0 {
+		v = float64(int32(rk) >> 2)
+	} else {
+		v = math.Float64frombits(uint64(rk&^3) << 32)
+	}
+	if rk&1 != 0 {
+		v /= 100
+	}
+	return v
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func cellName(row, col int) string {
+	var s string
+	for col++; col > 0; col = (col - 1) / 26 {
+		s = string(rune('A'+(col-1)%26)) + s
+	}
+	return s + strconv.Itoa(row+1)
+}
+
+// cursor reads data that may be split across CONTINUE records.
+type cursor struct {
+	segs [][]byte
+}
+
+var errShort = errors.New("unexpected end of record")
+
+func (c *cursor) next() bool {
+	for len(c.segs) > 0 && len(c.segs[0]) == 0 {
+		c.segs = c.segs[1:]
+	}
+	return len(c.segs) > 0
+}
+
+func (c *cursor) bytes(n int) ([]byte, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	if !c.next() {
+		return nil, errShort
+	}
+	if len(c.segs[0]) >= n {
+		b := c.segs[0][:n]
+		c.segs[0] = c.segs[0][n:]
+		return b, nil
+	}
+
+	// The value is split across records
+	b := make([]byte, 0, n)
+	for len(b) < n {
+		if !c.next() {
+			return nil, errShort
+		}
+		m := min(n-len(b), len(c.segs[0]))
+		b = append(b, c.segs[0][:m]...)
+		c.segs[0] = c.segs[0][m:]
+	}
+	return b, nil
+}
+
+func (c *cursor) skip(n int) error {
+	_, err := c.bytes(n)
+	return err
+}
+
+func (c *cursor) u8() (uint8, error) {
+	b, err := c.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (c *cursor) u16() (uint16, error) {
+	b, err := c.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (c *cursor) u32() (uint32, error) {
+	b, err := c.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// chars reads a flags byte followed by n characters.
+func (c *cursor) chars(n int) (string, error) {
+	flags, err := c.u8()
+	if err != nil {
+		return "", err
+	}
+	return c.charData(n, flags&1 != 0)
+}
+
+// charData reads n characters, which are UTF-16 if wide is set and Latin-1
+// otherwise. When the characters are split across records, the continuation
+// starts with a flags byte that specifies the width of the remaining
+// characters.
+func (c *cursor) charData(n int, wide bool) (string, error) {
+	u := make([]uint16, 0, n)
+	for len(u) < n {
+		if !c.next() {
+			return "", errShort
+		}
+		seg := c.segs[0]
+		for len(u) < n && len(seg) > 0 {
+			if wide {
+				if len(seg) < 2 {
+					return "", errShort
+				}
+				u = append(u, binary.LittleEndian.Uint16(seg))
+				seg = seg[2:]
+			} else {
+				u = append(u, uint16(seg[0]))
+				seg = seg[1:]
+			}
+		}
+		c.segs[0] = seg
+		if len(u) < n {
+			c.segs = c.segs[1:]
+			flags, err := c.u8()
+			if err != nil {
+				return "", err
+			}
+			wide = flags&1 != 0
+		}
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// xlString reads an XLUnicodeString.
+func (c *cursor) xlString() (string, error) {
+	n, err := c.u16()
+	if err != nil {
+		return "", err
+	}
+	return c.chars(int(n))
+}
+
+// unicodeString reads an XLUnicodeRichExtendedString, discarding formatting
+// runs and phonetic data.
+func (c *cursor) unicodeString() (string, error) {
+	n, err := c.u16()
+	if err != nil {
+		return "", err
+	}
+	flags, err := c.u8()
+	if err != nil {
+		return "", err
+	}
+	var runs uint16
+	var ext uint32
+	if flags&8 != 0 {
+		runs, err = c.u16()
+		if err != nil {
+			return "", err
+		}
+	}
+	if flags&4 != 0 {
+		ext, err = c.u32()
+		if err != nil {
+			return "", err
+		}
+	}
+	s, err := c.charData(int(n), flags&1 != 0)
+	if err != nil {
+		return "", err
+	}
+	if err := c.skip(4*int(runs) + int(ext)); err != nil {
+		return "", err
+	}
+	return s, nil
+}
@@ -0,0 +1,43 @@
+package xls_test
+
+import (
+	"testing"
+
+	"github.com/TradesmanUS/LV8RLABS/rules/pkg/xls"
+)
+
+func TestOpen(t *testing.T) {
+	w, err := xls.Open("../rules/edd.xls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Sheets) == 0 {
+		t.Fatal("no sheets")
+	}
+
+	s := w.Sheets[0]
+	cases := []struct {
+		row, col int
+		value    string
+	}{
+		{0, 0, "Entity"},
+		{0, 7, "comment"},
+		{2, 1, "denialReason"},
+		{2, 3, "string"},
+		{3, 0, ""},
+		{7, 1, "toDate"},
+		{100, 100, ""},
+	}
+	for _, c := range cases {
+		if v := s.Cell(c.row, c.col); v != c.value {
+			t.Errorf("cell (%d, %d): want %q, got %q", c.row, c.col, c.value, v)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := xls.Parse([]byte("<entity_data_dictionary/>"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}